@@ -0,0 +1,83 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// updateRetentionRequest is the body of PUT /admin/tenants/:tenantId/retention.
+// Omitted fields are left unchanged.
+type updateRetentionRequest struct {
+	NormalDays  *int `json:"normal_days"`
+	AnomalyDays *int `json:"anomaly_days"`
+}
+
+func retentionJSON(policy db.RetentionPolicy) gin.H {
+	return gin.H{
+		"tenant_id":    policy.TenantID,
+		"normal_days":  policy.NormalDays,
+		"anomaly_days": policy.AnomalyDays,
+		"is_default":   policy.UpdatedAt == "",
+		"updated_at":   policy.UpdatedAt,
+	}
+}
+
+// Get a tenant's data retention policy
+func (s *Server) handleGetRetention(c *gin.Context) {
+	tenantID := c.Param("tenantId")
+
+	policy, err := s.store.GetRetentionPolicy(c.Request.Context(), tenantID)
+	if err != nil {
+		log.Printf("Failed to get retention policy for %s: %v", tenantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get retention policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, retentionJSON(*policy))
+}
+
+// Change a tenant's data retention policy. The new periods apply to data
+// written from now on.
+func (s *Server) handleUpdateRetention(c *gin.Context) {
+	tenantID := c.Param("tenantId")
+
+	var req updateRetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	policy, err := s.store.GetRetentionPolicy(ctx, tenantID)
+	if err != nil {
+		log.Printf("Failed to get retention policy for %s: %v", tenantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retention policy"})
+		return
+	}
+
+	if req.NormalDays != nil {
+		policy.NormalDays = *req.NormalDays
+	}
+	if req.AnomalyDays != nil {
+		policy.AnomalyDays = *req.AnomalyDays
+	}
+
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := s.store.PutRetentionPolicy(ctx, *policy)
+	if err != nil {
+		log.Printf("Failed to update retention policy for %s: %v", tenantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retention policy"})
+		return
+	}
+
+	log.Printf("Retention for %s set to %d days (anomalies: %d days)", tenantID, updated.NormalDays, updated.AnomalyDays)
+
+	c.JSON(http.StatusOK, retentionJSON(*updated))
+}
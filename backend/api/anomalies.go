@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+const defaultAnomalyWindow = 7 * 24 * time.Hour
+
+// AnomalyEventJSON is a stored anomaly event as returned by the API
+type AnomalyEventJSON struct {
+	DeviceID    string  `json:"device_id"`
+	Timestamp   string  `json:"timestamp"`
+	AnomalyType string  `json:"anomaly_type"`
+	Reason      string  `json:"reason"`
+	Severity    string  `json:"severity"`
+	Metric      string  `json:"metric,omitempty"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+	HeartRate   int     `json:"hr_bpm"`
+	TempC       float64 `json:"temp_c"`
+	SpO2        int     `json:"spo2_pct"`
+}
+
+// Get a tenant's anomaly history, newest first
+//
+// Query parameters:
+//
+//	device_id  only events from this device
+//	type       only events of this type (e.g. hypoxia)
+//	from, to   RFC3339 bounds (default: the last 7 days)
+//	limit      page size, 1-1000 (default 100)
+//	cursor     next_cursor from a previous page
+//
+// A page may hold fewer than limit events while next_cursor is still set;
+// keep paging until next_cursor is empty.
+func (s *Server) handleGetAnomalies(c *gin.Context) {
+	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
+
+	from, to, err := parseTimeRange(c, defaultAnomalyWindow)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := s.store.QueryAnomalies(c.Request.Context(), tenantID, db.AnomalyQuery{
+		DeviceID:    c.Query("device_id"),
+		AnomalyType: c.Query("type"),
+		From:        from,
+		To:          to,
+		Limit:       int32(limit),
+		Cursor:      c.Query("cursor"),
+	})
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Printf("Failed to query anomalies for %s: %v", tenantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query anomalies"})
+		return
+	}
+
+	anomalies := make([]AnomalyEventJSON, 0, len(page.Events))
+	for _, event := range page.Events {
+		anomalies = append(anomalies, AnomalyEventJSON{
+			DeviceID:    event.DeviceID,
+			Timestamp:   event.Timestamp,
+			AnomalyType: event.AnomalyType,
+			Reason:      event.Reason,
+			Severity:    event.Severity,
+			Metric:      event.Metric,
+			Value:       event.Value,
+			Threshold:   event.Threshold,
+			HeartRate:   event.HeartRate,
+			TempC:       event.TempC,
+			SpO2:        event.SpO2,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant_id":   tenantID,
+		"from":        from.Format(time.RFC3339),
+		"to":          to.Format(time.RFC3339),
+		"count":       len(anomalies),
+		"anomalies":   anomalies,
+		"next_cursor": page.NextCursor,
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+func TestGetAnomaliesKeepsZeroValues(t *testing.T) {
+	s, store, _ := newTestServer(t)
+	ts := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+
+	events := []db.AnomalyEvent{
+		{TenantID: "acme-clinic", DeviceID: "patient-001", Timestamp: ts, AnomalyType: "tachycardia",
+			Severity: "warning", Metric: "hr_bpm", Value: 160, Threshold: 150},
+		{TenantID: "acme-clinic", DeviceID: "patient-002", Timestamp: ts, AnomalyType: "early_warning",
+			Severity: "info", Metric: "ews_score", Value: 0, Threshold: 0},
+	}
+	for _, event := range events {
+		if err := store.PutAnomaly(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var body struct {
+		Anomalies []map[string]any `json:"anomalies"`
+	}
+	if code := get(t, s, "/api/v1/anomalies?tenant_id=acme-clinic", &body); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if len(body.Anomalies) != len(events) {
+		t.Fatalf("got %d anomalies, want %d", len(body.Anomalies), len(events))
+	}
+	for _, anomaly := range body.Anomalies {
+		for _, field := range []string{"severity", "value", "threshold"} {
+			if _, ok := anomaly[field]; !ok {
+				t.Errorf("%s anomaly has no %s: %v", anomaly["anomaly_type"], field, anomaly)
+			}
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// createDeviceRequest is the body of POST /devices
+type createDeviceRequest struct {
+	DeviceID  string `json:"device_id" binding:"required"`
+	Model     string `json:"model"`
+	FWVersion string `json:"fw_version"`
+	PatientID string `json:"patient_id"`
+	Ward      string `json:"ward"`
+	Status    string `json:"status"`
+}
+
+// updateDeviceRequest is the body of PUT /devices/:deviceId. Omitted fields
+// are left unchanged.
+type updateDeviceRequest struct {
+	Model     *string `json:"model"`
+	FWVersion *string `json:"fw_version"`
+	PatientID *string `json:"patient_id"`
+	Ward      *string `json:"ward"`
+	Status    *string `json:"status"`
+}
+
+func deviceJSON(device db.Device) gin.H {
+	return gin.H{
+		"device_id":  device.DeviceID,
+		"tenant_id":  device.TenantID,
+		"model":      device.Model,
+		"fw_version": device.FWVersion,
+		"patient_id": device.PatientID,
+		"ward":       device.Ward,
+		"status":     device.Status,
+		"created_at": device.CreatedAt,
+		"updated_at": device.UpdatedAt,
+	}
+}
+
+// Get all registered devices with their latest telemetry
+func (s *Server) handleGetDevices(c *gin.Context) {
+	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
+	ctx := c.Request.Context()
+
+	registered, err := s.store.ListDevices(ctx, tenantID)
+	if err != nil {
+		log.Printf("Failed to list devices for %s: %v", tenantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list devices"})
+		return
+	}
+
+	devices := make([]gin.H, 0, len(registered))
+	latestReadings := s.getLatestAll(ctx, tenantID, registered)
+
+	for i, device := range registered {
+		entry := deviceJSON(device)
+
+		// Devices that have never reported are still listed, just without vitals
+		latest, err := latestReadings[i].latest, latestReadings[i].err
+		if err == nil {
+			entry["timestamp"] = latest.Timestamp
+			entry["hr_bpm"] = latest.HeartRate
+			entry["temp_c"] = latest.TempC
+			entry["spo2_pct"] = latest.SpO2
+			entry["steps"] = latest.Steps
+			entry["battery_pct"] = latest.BatteryPct
+			entry["anomaly_flag"] = latest.AnomalyFlag
+			entry["anomaly_type"] = latest.AnomalyType
+			entry["quality_flags"] = latest.QualityFlags
+			entry["ews_score"] = latest.EWSScore
+			entry["ews_band"] = latest.EWSBand
+			entry["stale"] = isStale(latest)
+		} else if !errors.Is(err, db.ErrNoTelemetry) {
+			log.Printf("Failed to get latest for %s: %v", device.DeviceID, err)
+		}
+
+		devices = append(devices, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant_id": tenantID,
+		"count":     len(devices),
+		"devices":   devices,
+	})
+}
+
+// maxLatestLookups bounds the latest readings read at once for a device
+// list, so a cold cache does not turn one request into a burst of store
+// queries
+const maxLatestLookups = 8
+
+// latestResult is one device's latest reading, or why there is none
+type latestResult struct {
+	latest *cache.LatestTelemetry
+	err    error
+}
+
+// getLatestAll reads the latest reading of each device through the cache,
+// with at most maxLatestLookups reads in flight. Cache misses are filled
+// from the store and repopulate the cache.
+func (s *Server) getLatestAll(ctx context.Context, tenantID string, devices []db.Device) []latestResult {
+	results := make([]latestResult, len(devices))
+	sem := make(chan struct{}, maxLatestLookups)
+	var wg sync.WaitGroup
+
+	for i, device := range devices {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, deviceID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			latest, _, err := s.getLatest(ctx, tenantID, deviceID)
+			results[i] = latestResult{latest: latest, err: err}
+		}(i, device.DeviceID)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// Register a new device
+func (s *Server) handleCreateDevice(c *gin.Context) {
+	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
+
+	var req createDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	if req.Status != "" && !db.ValidDeviceStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, inactive or retired"})
+		return
+	}
+
+	device := db.Device{
+		TenantID:  tenantID,
+		DeviceID:  req.DeviceID,
+		Model:     req.Model,
+		FWVersion: req.FWVersion,
+		PatientID: req.PatientID,
+		Ward:      req.Ward,
+		Status:    req.Status,
+	}
+
+	created, err := s.store.CreateDevice(c.Request.Context(), device)
+	if errors.Is(err, db.ErrDeviceExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device already registered"})
+		return
+	} else if err != nil {
+		log.Printf("Failed to create device %s: %v", req.DeviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create device"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, deviceJSON(*created))
+}
+
+// Get a single registry entry
+func (s *Server) handleGetDevice(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
+
+	device, err := s.store.GetDevice(c.Request.Context(), tenantID, deviceID)
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	} else if err != nil {
+		log.Printf("Failed to get device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deviceJSON(*device))
+}
+
+// Update device metadata
+func (s *Server) handleUpdateDevice(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
+
+	var req updateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	if req.Status != nil && !db.ValidDeviceStatus(*req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, inactive or retired"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	device, err := s.store.GetDevice(ctx, tenantID, deviceID)
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	} else if err != nil {
+		log.Printf("Failed to get device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		return
+	}
+
+	if req.Model != nil {
+		device.Model = *req.Model
+	}
+	if req.FWVersion != nil {
+		device.FWVersion = *req.FWVersion
+	}
+	if req.PatientID != nil {
+		device.PatientID = *req.PatientID
+	}
+	if req.Ward != nil {
+		device.Ward = *req.Ward
+	}
+	if req.Status != nil {
+		device.Status = *req.Status
+	}
+
+	updated, err := s.store.UpdateDevice(ctx, *device)
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	} else if err != nil {
+		log.Printf("Failed to update device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deviceJSON(*updated))
+}
+
+// Remove a device from the registry
+func (s *Server) handleDeleteDevice(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
+
+	err := s.store.DeleteDevice(c.Request.Context(), tenantID, deviceID)
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	} else if err != nil {
+		log.Printf("Failed to delete device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+)
+
+// countingStore tracks how many latest readings are read at once
+type countingStore struct {
+	*db.MemoryStore
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	calls    int
+}
+
+func (s *countingStore) GetLatestTelemetry(ctx context.Context, tenantID, deviceID string) (*db.TelemetryRecord, error) {
+	s.mu.Lock()
+	s.inFlight++
+	s.calls++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return s.MemoryStore.GetLatestTelemetry(ctx, tenantID, deviceID)
+}
+
+func TestGetDevicesColdCache(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryStore: db.NewMemoryStore()}
+	latest := cache.NewMemoryCache()
+	bus := pubsub.NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+	s := NewServer(store, latest, bus, []string{"*"})
+
+	const devices = 30
+	ts := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	for i := 0; i < devices; i++ {
+		deviceID := fmt.Sprintf("patient-%03d", i)
+		if _, err := store.CreateDevice(ctx, db.Device{TenantID: "acme-clinic", DeviceID: deviceID, Status: db.DeviceStatusActive}); err != nil {
+			t.Fatal(err)
+		}
+		// Every third device has never reported
+		if i%3 == 0 {
+			continue
+		}
+		record := db.TelemetryRecord{TenantID: "acme-clinic", DeviceID: deviceID, Timestamp: ts.Format(time.RFC3339), HeartRate: 60 + i}
+		if err := store.PutTelemetry(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var body struct {
+		Count   int              `json:"count"`
+		Devices []map[string]any `json:"devices"`
+	}
+	if code := get(t, s, "/api/v1/devices?tenant_id=acme-clinic", &body); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if body.Count != devices {
+		t.Fatalf("listed %d devices, want %d", body.Count, devices)
+	}
+	for i, device := range body.Devices {
+		hr, reported := device["hr_bpm"]
+		if want := i%3 != 0; reported != want {
+			t.Errorf("%s: has vitals %v, want %v", device["device_id"], reported, want)
+		} else if reported && hr != float64(60+i) {
+			t.Errorf("%s: hr_bpm %v, want %d", device["device_id"], hr, 60+i)
+		}
+	}
+	if store.peak > maxLatestLookups {
+		t.Errorf("%d latest readings read at once, want at most %d", store.peak, maxLatestLookups)
+	}
+
+	// The store's answers repopulated the cache
+	calls := store.calls
+	if code := get(t, s, "/api/v1/devices?tenant_id=acme-clinic", &body); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if got, want := store.calls-calls, devices/3; got != want {
+		t.Errorf("second request read the store %d times, want %d for the devices that never reported", got, want)
+	}
+}
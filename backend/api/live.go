@@ -0,0 +1,15 @@
+package api
+
+import (
+	"log"
+
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+)
+
+// relayLive feeds live updates from the bus to this instance's clients
+func (s *Server) relayLive(events <-chan pubsub.Message) {
+	for event := range events {
+		s.wsHub.broadcastRaw(event.TenantID, event.Payload)
+	}
+	log.Printf("Live update subscription closed")
+}
@@ -2,31 +2,38 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/meghanan266/healthsense/backend/pkg/cache"
 	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
 )
 
 type Server struct {
 	router      *gin.Engine
-	ddbClient   *db.DynamoDBClient
-	redisClient *cache.RedisClient
+	store       db.Store
+	latestCache cache.LatestCache
+	bus         pubsub.Bus
 	wsHub       *WSHub
+	upgrader    websocket.Upgrader
 }
 
-// NewServer creates and configures the API server
-func NewServer(ddbClient *db.DynamoDBClient, redisClient *cache.RedisClient) *Server {
+// NewServer creates and configures the API server. Live updates published on
+// bus are relayed to the server's WebSocket clients. Browsers may call the API
+// from corsOrigins, where "*" allows any origin.
+func NewServer(store db.Store, latestCache cache.LatestCache, bus pubsub.Bus, corsOrigins []string) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
-	// CORS configuration for local development
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000"},
+		AllowOrigins:     corsOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
@@ -39,9 +46,11 @@ func NewServer(ddbClient *db.DynamoDBClient, redisClient *cache.RedisClient) *Se
 
 	server := &Server{
 		router:      router,
-		ddbClient:   ddbClient,
-		redisClient: redisClient,
+		store:       store,
+		latestCache: latestCache,
+		bus:         bus,
 		wsHub:       wsHub,
+		upgrader:    newUpgrader(corsOrigins),
 	}
 
 	server.setupRoutes()
@@ -57,33 +66,31 @@ func (s *Server) setupRoutes() {
 	{
 		// Public routes (no auth for now - will add JWT later)
 		v1.GET("/devices", s.handleGetDevices)
+		v1.POST("/devices", s.handleCreateDevice)
+		v1.GET("/devices/:deviceId", s.handleGetDevice)
+		v1.PUT("/devices/:deviceId", s.handleUpdateDevice)
+		v1.DELETE("/devices/:deviceId", s.handleDeleteDevice)
 		v1.GET("/devices/:deviceId/latest", s.handleGetLatestTelemetry)
 		v1.GET("/devices/:deviceId/timeseries", s.handleGetTimeseries)
+		v1.GET("/anomalies", s.handleGetAnomalies)
+
+		// Tenant administration
+		v1.GET("/admin/tenants/:tenantId/retention", s.handleGetRetention)
+		v1.PUT("/admin/tenants/:tenantId/retention", s.handleUpdateRetention)
 		
 		// WebSocket endpoint
 		v1.GET("/ws", s.handleWebSocket)
-
-		// Internal broadcast endpoint (for consumer)
-		v1.POST("/internal/broadcast", s.handleInternalBroadcast)
 	}
 }
 
-// Internal endpoint for consumer to push telemetry for WebSocket broadcast
-func (s *Server) handleInternalBroadcast(c *gin.Context) {
-	var msg WSMessage
-	if err := c.ShouldBindJSON(&msg); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
-		return
+// Start subscribes to live updates and runs the HTTP server
+func (s *Server) Start(addr string) error {
+	events, err := s.bus.Subscribe(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to live updates: %w", err)
 	}
-	
-	// Broadcast to all connected WebSocket clients
-	s.wsHub.Broadcast(msg)
-	
-	c.JSON(http.StatusOK, gin.H{"status": "broadcasted"})
-}
+	go s.relayLive(events)
 
-// Start runs the HTTP server
-func (s *Server) Start(addr string) error {
 	log.Printf("API Server starting on %s", addr)
 	return s.router.Run(addr)
 }
@@ -97,75 +104,84 @@ func (s *Server) handleHealth(c *gin.Context) {
 	})
 }
 
-// Get all devices with latest telemetry
-func (s *Server) handleGetDevices(c *gin.Context) {
-	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
-	
-	// For now, we'll hardcode device IDs (in production, these would come from a device registry)
-	deviceIDs := []string{"watch-0000", "watch-0001", "watch-0002", "watch-0003", "watch-0004"}
-	
-	ctx := context.Background()
-	devices := make([]gin.H, 0)
-	
-	for _, deviceID := range deviceIDs {
-		latest, err := s.redisClient.GetLatest(ctx, tenantID, deviceID)
-		if err != nil {
-			log.Printf("Failed to get latest for %s: %v", deviceID, err)
-			continue
-		}
-		
-		devices = append(devices, gin.H{
-			"device_id":   latest.DeviceID,
-			"timestamp":   latest.Timestamp,
-			"hr_bpm":      latest.HeartRate,
-			"temp_c":      latest.TempC,
-			"spo2_pct":    latest.SpO2,
-			"steps":       latest.Steps,
-			"battery_pct": latest.BatteryPct,
-		})
-	}
-	
-	c.JSON(http.StatusOK, gin.H{
-		"tenant_id": tenantID,
-		"count":     len(devices),
-		"devices":   devices,
-	})
-}
-
 // Get latest telemetry for a specific device
 func (s *Server) handleGetLatestTelemetry(c *gin.Context) {
 	deviceID := c.Param("deviceId")
 	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
-	
-	ctx := context.Background()
-	latest, err := s.redisClient.GetLatest(ctx, tenantID, deviceID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found or no recent data"})
+
+	latest, source, err := s.getLatest(c.Request.Context(), tenantID, deviceID)
+	if errors.Is(err, db.ErrNoTelemetry) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found or no data"})
+		return
+	} else if err != nil {
+		log.Printf("Failed to get latest for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get latest telemetry"})
 		return
 	}
-	
+
 	c.JSON(http.StatusOK, gin.H{
-		"device_id":   latest.DeviceID,
-		"timestamp":   latest.Timestamp,
-		"hr_bpm":      latest.HeartRate,
-		"temp_c":      latest.TempC,
-		"spo2_pct":    latest.SpO2,
-		"steps":       latest.Steps,
-		"battery_pct": latest.BatteryPct,
+		"device_id":     latest.DeviceID,
+		"timestamp":     latest.Timestamp,
+		"hr_bpm":        latest.HeartRate,
+		"temp_c":        latest.TempC,
+		"spo2_pct":      latest.SpO2,
+		"steps":         latest.Steps,
+		"battery_pct":   latest.BatteryPct,
+		"fw_version":    latest.FWVersion,
+		"anomaly_flag":  latest.AnomalyFlag,
+		"anomaly_type":  latest.AnomalyType,
+		"quality_flags": latest.QualityFlags,
+		"ews_score":     latest.EWSScore,
+		"ews_band":      latest.EWSBand,
+		"source":        source,
+		"stale":         isStale(latest),
 	})
 }
 
-// Get timeseries data from DynamoDB
-func (s *Server) handleGetTimeseries(c *gin.Context) {
-	deviceID := c.Param("deviceId")
-	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
-	
-	// For now, return a simple response
-	// In production, this would query DynamoDB with time range filters
-	c.JSON(http.StatusOK, gin.H{
-		"device_id": deviceID,
-		"tenant_id": tenantID,
-		"message":   "Timeseries endpoint - DynamoDB query to be implemented",
-		"data":      []gin.H{},
-	})
-}
\ No newline at end of file
+// getLatest reads a device's latest reading through the cache: cache first,
+// then the store, repopulating the cache on a miss. It also reports which of
+// the two served the value.
+func (s *Server) getLatest(ctx context.Context, tenantID, deviceID string) (*cache.LatestTelemetry, string, error) {
+	latest, err := s.latestCache.GetLatest(ctx, tenantID, deviceID)
+	if err == nil {
+		return latest, "cache", nil
+	}
+
+	record, err := s.store.GetLatestTelemetry(ctx, tenantID, deviceID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ts, err := time.Parse(time.RFC3339, record.Timestamp)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid stored timestamp %q: %w", record.Timestamp, err)
+	}
+
+	latest = &cache.LatestTelemetry{
+		DeviceID:     record.DeviceID,
+		Timestamp:    ts,
+		HeartRate:    record.HeartRate,
+		TempC:        record.TempC,
+		SpO2:         record.SpO2,
+		Steps:        record.Steps,
+		BatteryPct:   record.BatteryPct,
+		FWVersion:    record.FWVersion,
+		AnomalyFlag:  record.AnomalyFlag,
+		AnomalyType:  record.AnomalyType,
+		QualityFlags: record.QualityFlags,
+		EWSScore:     record.EWSScore,
+		EWSBand:      record.EWSBand,
+	}
+
+	if err := s.latestCache.SetLatest(ctx, tenantID, deviceID, *latest); err != nil {
+		log.Printf("Failed to repopulate cache for %s: %v", deviceID, err)
+	}
+
+	return latest, "store", nil
+}
+
+// isStale reports whether a reading is older than the cache window, meaning
+// the device has not reported recently
+func isStale(latest *cache.LatestTelemetry) bool {
+	return time.Since(latest.Timestamp) > cache.LatestTTL
+}
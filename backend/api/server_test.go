@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+)
+
+// newTestServer creates a server on in-memory storage
+func newTestServer(t *testing.T) (*Server, *db.MemoryStore, *cache.MemoryCache) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	latest := cache.NewMemoryCache()
+	bus := pubsub.NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+	return NewServer(store, latest, bus, []string{"*"}), store, latest
+}
+
+// get requests path and decodes the JSON response into out
+func get(t *testing.T, s *Server, path string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if out != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("GET %s: invalid JSON %q: %v", path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
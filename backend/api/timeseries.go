@@ -0,0 +1,275 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+const (
+	defaultTimeseriesWindow = time.Hour
+	defaultTimeseriesLimit  = 100
+	maxTimeseriesLimit      = 1000
+)
+
+// timeseriesBuckets are the bucket widths accepted by the bucket parameter
+var timeseriesBuckets = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+}
+
+// timeseriesAggs are the aggregations accepted by the agg parameter
+var timeseriesAggs = map[string]bool{
+	"min":   true,
+	"max":   true,
+	"avg":   true,
+	"count": true,
+	"last":  true,
+}
+
+// TelemetryReading is a single stored reading as returned by the API
+type TelemetryReading struct {
+	Timestamp    string   `json:"timestamp"`
+	HeartRate    int      `json:"hr_bpm"`
+	TempC        float64  `json:"temp_c"`
+	SpO2         int      `json:"spo2_pct"`
+	Steps        int      `json:"steps"`
+	BatteryPct   int      `json:"battery_pct"`
+	AnomalyFlag  bool     `json:"anomaly_flag"`
+	AnomalyType  string   `json:"anomaly_type,omitempty"`
+	QualityFlags []string `json:"quality_flags,omitempty"`
+	EWSScore     *int     `json:"ews_score,omitempty"`
+	EWSBand      string   `json:"ews_band,omitempty"`
+}
+
+func newTelemetryReading(record db.TelemetryRecord) TelemetryReading {
+	return TelemetryReading{
+		Timestamp:    record.Timestamp,
+		HeartRate:    record.HeartRate,
+		TempC:        record.TempC,
+		SpO2:         record.SpO2,
+		Steps:        record.Steps,
+		BatteryPct:   record.BatteryPct,
+		AnomalyFlag:  record.AnomalyFlag,
+		AnomalyType:  record.AnomalyType,
+		QualityFlags: record.QualityFlags,
+		EWSScore:     record.EWSScore,
+		EWSBand:      record.EWSBand,
+	}
+}
+
+// Get timeseries data from the store
+//
+// Query parameters:
+//
+//	from, to  RFC3339 bounds (default: the last hour)
+//	limit     page size, 1-1000 (default 100)
+//	order     asc or desc (default asc)
+//	cursor    next_cursor from a previous page
+//	bucket    1m, 5m or 1h to return aggregated buckets instead of readings
+//	agg       comma-separated min,max,avg,count,last (default avg)
+func (s *Server) handleGetTimeseries(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
+
+	from, to, err := parseTimeRange(c, defaultTimeseriesWindow)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("bucket") != "" {
+		s.handleGetAggregatedTimeseries(c, tenantID, deviceID, from, to)
+		return
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order := c.DefaultQuery("order", "asc")
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+
+	result, err := s.store.QueryTelemetry(c.Request.Context(), tenantID, deviceID, db.QueryOptions{
+		From:      from,
+		To:        to,
+		Limit:     int32(limit),
+		Ascending: order == "asc",
+		Cursor:    c.Query("cursor"),
+	})
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Printf("Failed to query timeseries for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query telemetry"})
+		return
+	}
+
+	data := make([]TelemetryReading, 0, len(result.Records))
+	for _, record := range result.Records {
+		data = append(data, newTelemetryReading(record))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id":   deviceID,
+		"tenant_id":   tenantID,
+		"from":        from.Format(time.RFC3339),
+		"to":          to.Format(time.RFC3339),
+		"order":       order,
+		"count":       len(data),
+		"data":        data,
+		"next_cursor": result.NextCursor,
+	})
+}
+
+// handleGetAggregatedTimeseries returns one point per bucket, with the
+// requested aggregations for every metric and the bucket's anomaly count
+func (s *Server) handleGetAggregatedTimeseries(c *gin.Context, tenantID, deviceID string, from, to time.Time) {
+	bucketName := c.Query("bucket")
+	width, ok := timeseriesBuckets[bucketName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bucket must be one of 1m, 5m, 1h"})
+		return
+	}
+
+	if to.Sub(from) > db.MaxAggregateWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time range too large for aggregation (max 31 days)"})
+		return
+	}
+
+	aggs, err := parseAggs(c.DefaultQuery("agg", "avg"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	buckets, err := s.store.AggregateTelemetry(c.Request.Context(), tenantID, deviceID, from, to, width)
+	if errors.Is(err, db.ErrAggregateTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Printf("Failed to aggregate timeseries for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate telemetry"})
+		return
+	}
+
+	data := make([]gin.H, 0, len(buckets))
+	for _, bucket := range buckets {
+		point := gin.H{
+			"timestamp":     bucket.Start.Format(time.RFC3339),
+			"anomaly_count": bucket.AnomalyCount,
+		}
+
+		for _, name := range db.AggregateMetrics {
+			stats, ok := bucket.Metrics[name]
+			if !ok {
+				continue
+			}
+
+			values := gin.H{}
+			for _, agg := range aggs {
+				switch agg {
+				case "min":
+					values["min"] = stats.Min
+				case "max":
+					values["max"] = stats.Max
+				case "avg":
+					values["avg"] = stats.Avg
+				case "count":
+					values["count"] = bucket.Count
+				case "last":
+					values["last"] = stats.Last
+				}
+			}
+			point[name] = values
+		}
+
+		data = append(data, point)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"tenant_id": tenantID,
+		"from":      from.Format(time.RFC3339),
+		"to":        to.Format(time.RFC3339),
+		"bucket":    bucketName,
+		"agg":       aggs,
+		"count":     len(data),
+		"data":      data,
+	})
+}
+
+// parseAggs splits and validates the agg parameter
+func parseAggs(v string) ([]string, error) {
+	aggs := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, agg := range strings.Split(v, ",") {
+		agg = strings.TrimSpace(agg)
+		if !timeseriesAggs[agg] {
+			return nil, fmt.Errorf("unknown aggregation %q (expected min, max, avg, count or last)", agg)
+		}
+		if !seen[agg] {
+			seen[agg] = true
+			aggs = append(aggs, agg)
+		}
+	}
+
+	return aggs, nil
+}
+
+// parseTimeRange reads the from/to query parameters, defaulting to the
+// given window ending now
+func parseTimeRange(c *gin.Context, window time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be an RFC3339 timestamp")
+		}
+		to = t.UTC()
+	}
+
+	from := to.Add(-window)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be an RFC3339 timestamp")
+		}
+		from = t.UTC()
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+
+	return from, to, nil
+}
+
+func parseLimit(c *gin.Context) (int, error) {
+	v := c.Query("limit")
+	if v == "" {
+		return defaultTimeseriesLimit, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxTimeseriesLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxTimeseriesLimit)
+	}
+
+	return limit, nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// timeseriesPage is the part of a timeseries response the tests check
+type timeseriesPage struct {
+	Count      int                `json:"count"`
+	Data       []TelemetryReading `json:"data"`
+	NextCursor string             `json:"next_cursor"`
+}
+
+func TestGetTimeseriesPagination(t *testing.T) {
+	ctx := context.Background()
+	s, store, _ := newTestServer(t)
+
+	base := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		record := db.TelemetryRecord{TenantID: "acme-clinic", DeviceID: "patient-001", Timestamp: base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339), HeartRate: 70 + i}
+		if err := store.PutTelemetry(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  [][]int // Heart rates on each page
+	}{
+		{name: "defaults to ascending", query: url.Values{}, want: [][]int{{70, 71, 72, 73, 74}}},
+		{name: "ascending pages", query: url.Values{"limit": {"2"}}, want: [][]int{{70, 71}, {72, 73}, {74}}},
+		{name: "descending pages", query: url.Values{"limit": {"2"}, "order": {"desc"}}, want: [][]int{{74, 73}, {72, 71}, {70}}},
+		{name: "narrower range", query: url.Values{"limit": {"2"}, "from": {"2025-01-06T12:01:00Z"}, "to": {"2025-01-06T12:03:00Z"}}, want: [][]int{{71, 72}, {73}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"from": {"2025-01-06T12:00:00Z"}, "to": {"2025-01-06T13:00:00Z"}}
+			for k, v := range tt.query {
+				query[k] = v
+			}
+
+			var got [][]int
+			for page := 0; ; page++ {
+				if page > len(tt.want) {
+					t.Fatalf("more than %d pages", len(tt.want))
+				}
+
+				var resp timeseriesPage
+				if code := get(t, s, "/api/v1/devices/patient-001/timeseries?"+query.Encode(), &resp); code != http.StatusOK {
+					t.Fatalf("page %d: status %d", page, code)
+				}
+				if resp.Count != len(resp.Data) {
+					t.Errorf("count %d for %d readings", resp.Count, len(resp.Data))
+				}
+
+				rates := make([]int, 0, len(resp.Data))
+				for _, reading := range resp.Data {
+					rates = append(rates, reading.HeartRate)
+				}
+				got = append(got, rates)
+
+				if resp.NextCursor == "" {
+					break
+				}
+				query.Set("cursor", resp.NextCursor)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTimeseriesBadRequest(t *testing.T) {
+	s, _, _ := newTestServer(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "invalid cursor", query: "cursor=not-a-cursor"},
+		{name: "invalid order", query: "order=newest"},
+		{name: "limit too large", query: "limit=5000"},
+		{name: "invalid from", query: "from=yesterday"},
+		{name: "from after to", query: "from=2025-01-06T13:00:00Z&to=2025-01-06T12:00:00Z"},
+		{name: "unknown bucket", query: "bucket=10s"},
+		{name: "unknown aggregation", query: "bucket=1m&agg=avg,median"},
+		{name: "aggregation range too large", query: "bucket=1h&from=2025-01-01T00:00:00Z&to=2025-03-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := get(t, s, "/api/v1/devices/patient-001/timeseries?"+tt.query, nil); code != http.StatusBadRequest {
+				t.Errorf("status %d, want %d", code, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -9,24 +9,33 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for dev (restrict in production)
-	},
+// newUpgrader accepts WebSocket connections from the allowed origins, and
+// from clients such as CLI tools that send no Origin header
+func newUpgrader(allowedOrigins []string) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			for _, allowed := range allowedOrigins {
+				if allowed == "*" || allowed == origin {
+					return true
+				}
+			}
+			return false
+		},
+	}
 }
 
-// WSMessage represents a WebSocket message
-type WSMessage struct {
-	Type      string      `json:"type"`
-	DeviceID  string      `json:"device_id,omitempty"`
-	TenantID  string      `json:"tenant_id,omitempty"`
-	Timestamp string      `json:"timestamp,omitempty"`
-	Data      interface{} `json:"data,omitempty"`
-}
+// WSMessage represents a WebSocket message. Updates published by the
+// pipeline are built with pubsub.LiveMessage, the same type.
+type WSMessage = pubsub.LiveMessage
 
 // WSClient represents a connected WebSocket client
 type WSClient struct {
@@ -41,7 +50,7 @@ type WSClient struct {
 // WSHub manages WebSocket clients and broadcasts
 type WSHub struct {
 	clients    map[*WSClient]bool
-	broadcast  chan []byte
+	broadcast  chan hubMessage
 	register   chan *WSClient
 	unregister chan *WSClient
 	mu         sync.RWMutex
@@ -51,7 +60,7 @@ type WSHub struct {
 func NewWSHub() *WSHub {
 	return &WSHub{
 		clients:    make(map[*WSClient]bool),
-		broadcast:  make(chan []byte, 256),
+		broadcast:  make(chan hubMessage, 256),
 		register:   make(chan *WSClient),
 		unregister: make(chan *WSClient),
 	}
@@ -79,8 +88,12 @@ func (h *WSHub) Run() {
 		case message := <-h.broadcast:
 			h.mu.RLock()
 			for client := range h.clients {
+				// Clients only see their own tenant's devices
+				if message.tenantID != "" && message.tenantID != client.tenantID {
+					continue
+				}
 				select {
-				case client.send <- message:
+				case client.send <- message.data:
 				default:
 					close(client.send)
 					delete(h.clients, client)
@@ -91,21 +104,33 @@ func (h *WSHub) Run() {
 	}
 }
 
-// Broadcast sends a message to all connected clients
+// hubMessage is an encoded WSMessage and the tenant whose clients receive it
+type hubMessage struct {
+	tenantID string
+	data     []byte
+}
+
+// Broadcast sends a message to the connected clients of its tenant, or to
+// all clients if it has no tenant
 func (h *WSHub) Broadcast(msg WSMessage) {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		log.Printf("Failed to marshal WebSocket message: %v", err)
 		return
 	}
-	h.broadcast <- data
+	h.broadcastRaw(msg.TenantID, data)
+}
+
+// broadcastRaw sends an already encoded message to a tenant's clients
+func (h *WSHub) broadcastRaw(tenantID string, data []byte) {
+	h.broadcast <- hubMessage{tenantID: tenantID, data: data}
 }
 
 // Handle WebSocket connection
 func (s *Server) handleWebSocket(c *gin.Context) {
 	tenantID := c.DefaultQuery("tenant_id", "acme-clinic")
 	
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
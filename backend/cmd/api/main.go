@@ -4,46 +4,112 @@ import (
 	"context"
 	"flag"
 	"log"
+	"os"
 
 	"github.com/meghanan266/healthsense/backend/api"
 	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/config"
 	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/logging"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+	"github.com/meghanan266/healthsense/backend/pkg/timescale"
 )
 
 func main() {
+	// Settings come from the config file and environment; flags override them
+	configPath := config.PathFromArgs(os.Args[1:])
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	// Flags
-	port := flag.String("port", ":8080", "API server port")
-	ddbEndpoint := flag.String("ddb-endpoint", "http://localhost:8000", "DynamoDB endpoint")
-	ddbTable := flag.String("ddb-table", "healthsense-telemetry-dev", "DynamoDB table")
-	redisAddr := flag.String("redis", "localhost:6379", "Redis address")
+	flag.String("config", configPath, "YAML config file (or set $"+config.PathEnv+")")
+	port := flag.String("port", cfg.API.Addr, "API server port")
+	storeKind := flag.String("store", cfg.Store, "Storage backend: dynamodb or timescale (both with Redis), or memory")
+	ddbEndpoint := flag.String("ddb-endpoint", cfg.AWS.DynamoDBEndpoint, "DynamoDB endpoint")
+	ddbTable := flag.String("ddb-table", cfg.AWS.DynamoDBTable, "DynamoDB table")
+	pgDSN := flag.String("pg-dsn", cfg.Postgres.DSN, "TimescaleDB connection string")
+	redisAddr := flag.String("redis", cfg.Redis.Addr, "Redis address")
 	flag.Parse()
 
+	logging.SetLevel(cfg.LogLevel)
+	config.OnReload(configPath, func(cfg *config.Config) {
+		logging.SetLevel(cfg.LogLevel)
+	})
+
 	ctx := context.Background()
 
-	// Initialize DynamoDB
-	ddbClient, err := db.NewDynamoDBClient(ctx, *ddbEndpoint, "us-east-1", *ddbTable)
-	if err != nil {
-		log.Fatalf("Failed to create DynamoDB client: %v", err)
+	var store db.Store
+	var latestCache cache.LatestCache
+	var bus pubsub.Bus
+
+	switch *storeKind {
+	case "dynamodb":
+		// Initialize DynamoDB
+		ddbClient, err := db.NewDynamoDBClient(ctx, *ddbEndpoint, cfg.AWS.Region, *ddbTable)
+		if err != nil {
+			log.Fatalf("Failed to create DynamoDB client: %v", err)
+		}
+		store = ddbClient
+
+	case "timescale":
+		// Initialize TimescaleDB
+		tsClient, err := timescale.NewClient(ctx, *pgDSN)
+		if err != nil {
+			log.Fatalf("Failed to create TimescaleDB client: %v", err)
+		}
+		defer tsClient.Close()
+		store = tsClient
+
+	case "memory":
+		log.Printf("Using in-memory store (data is lost on exit)")
+		store = db.NewMemoryStore()
+		latestCache = cache.NewMemoryCache()
+		bus = pubsub.NewMemoryBus()
+
+	default:
+		log.Fatalf("Unknown store %q (expected dynamodb, timescale or memory)", *storeKind)
 	}
 
-	// Initialize Redis
-	redisClient, err := cache.NewRedisClient(*redisAddr)
-	if err != nil {
-		log.Fatalf("Failed to create Redis client: %v", err)
+	// Initialize Redis for the persistent backends
+	if latestCache == nil {
+		redisClient, err := cache.NewRedisClient(*redisAddr, cfg.Redis.Password)
+		if err != nil {
+			log.Fatalf("Failed to create Redis client: %v", err)
+		}
+		latestCache = redisClient
 	}
-	defer redisClient.Close()
+	defer latestCache.Close()
+
+	// Live updates arrive over Redis pub/sub from the consumers
+	if bus == nil {
+		redisBus, err := pubsub.NewRedisBus(*redisAddr, cfg.Redis.Password)
+		if err != nil {
+			log.Fatalf("Failed to create Redis pub/sub: %v", err)
+		}
+		bus = redisBus
+	}
+	defer bus.Close()
 
 	// Create and start server
-	server := api.NewServer(ddbClient, redisClient)
-	
+	server := api.NewServer(store, latestCache, bus, cfg.API.CORSOrigins)
+
 	log.Printf("API Documentation:")
 	log.Printf("   GET  /health")
 	log.Printf("   GET  /api/v1/devices")
+	log.Printf("   POST /api/v1/devices")
+	log.Printf("   GET  /api/v1/devices/:id")
+	log.Printf("   PUT  /api/v1/devices/:id")
+	log.Printf("   DEL  /api/v1/devices/:id")
 	log.Printf("   GET  /api/v1/devices/:id/latest")
 	log.Printf("   GET  /api/v1/devices/:id/timeseries")
+	log.Printf("   GET  /api/v1/anomalies")
+	log.Printf("   GET  /api/v1/admin/tenants/:id/retention")
+	log.Printf("   PUT  /api/v1/admin/tenants/:id/retention")
 	log.Printf("   GET  /api/v1/ws (WebSocket)")
-	
+
 	if err := server.Start(*port); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
-}
\ No newline at end of file
+}
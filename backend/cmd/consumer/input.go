@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+// maxInputLine is the longest NDJSON line accepted from -input
+const maxInputLine = 1 << 20
+
+// parsePace reads a -pace value: "realtime", a speed-up such as "10x", or
+// "fast". It returns the speed-up, with 0 meaning no pacing at all.
+func parsePace(pace string) (float64, error) {
+	switch pace {
+	case "fast":
+		return 0, nil
+	case "realtime":
+		return 1, nil
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(pace, "x"), 64)
+	if err != nil || !strings.HasSuffix(pace, "x") || speed <= 0 {
+		return 0, fmt.Errorf("%q is not realtime, fast or a speed-up such as 10x", pace)
+	}
+	return speed, nil
+}
+
+// openInput opens an NDJSON file, or stdin for "-"
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// inputClock is the current time on the recording's timeline: the timestamp
+// of the latest reading fed in. Validation judges late and future readings
+// against it, so a recording gets the same quality flags whenever it is
+// processed.
+type inputClock struct {
+	nanos atomic.Int64
+}
+
+// Now returns the clock's time, or the wall clock before any reading
+func (c *inputClock) Now() time.Time {
+	if n := c.nanos.Load(); n != 0 {
+		return time.Unix(0, n).UTC()
+	}
+	return time.Now()
+}
+
+func (c *inputClock) advance(t time.Time) {
+	for {
+		current := c.nanos.Load()
+		if t.UnixNano() <= current || c.nanos.CompareAndSwap(current, t.UnixNano()) {
+			return
+		}
+	}
+}
+
+// feedInput submits each line of r to the pool as if it had arrived over
+// MQTT, on the reading's telemetry topic. With a speed above zero, readings
+// are spaced out like their timestamps, divided by speed. It stops early if
+// ctx is cancelled and returns the number of readings submitted.
+func feedInput(ctx context.Context, pool *workerPool, r io.Reader, speed float64, clock *inputClock) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxInputLine)
+
+	var first time.Time // Timestamp of the first reading
+	var start time.Time // When the first reading was submitted
+	submitted := 0
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Only the routing fields are needed here; lines that do not parse
+		// are still submitted, so they reach the DLQ like bad MQTT payloads
+		var telemetry schema.Telemetry
+		topic := ""
+		var ts time.Time
+		if err := json.Unmarshal([]byte(line), &telemetry); err == nil {
+			if telemetry.TenantID != "" && telemetry.DeviceID != "" {
+				topic = fmt.Sprintf("tenants/%s/devices/%s/telemetry", telemetry.TenantID, telemetry.DeviceID)
+			}
+			ts, _ = time.Parse(time.RFC3339, telemetry.Timestamp)
+		}
+
+		if !ts.IsZero() {
+			if first.IsZero() {
+				first, start = ts, time.Now()
+			} else if speed > 0 {
+				due := start.Add(time.Duration(float64(ts.Sub(first)) / speed))
+				if wait := time.Until(due); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return submitted, ctx.Err()
+					}
+				}
+			}
+			clock.advance(ts)
+		}
+
+		if ctx.Err() != nil {
+			return submitted, ctx.Err()
+		}
+		if !pool.Submit(inbound{topic: topic, payload: []byte(line)}) {
+			return submitted, fmt.Errorf("worker pool closed")
+		}
+		submitted++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return submitted, fmt.Errorf("failed to read input: %w", err)
+	}
+	return submitted, nil
+}
@@ -1,197 +1,455 @@
 package main
 
 import (
-	"bytes"
-	"net/http"
 	"context"
-	"encoding/json"
 	"flag"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/meghanan266/healthsense/backend/api"
 	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
 	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/config"
 	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/dlq"
+	"github.com/meghanan266/healthsense/backend/pkg/logging"
+	"github.com/meghanan266/healthsense/backend/pkg/pipeline"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+	"github.com/meghanan266/healthsense/backend/pkg/spool"
+	"github.com/meghanan266/healthsense/backend/pkg/timescale"
 )
 
-// Telemetry matches simulator output
-type Telemetry struct {
-	TenantID   string  `json:"tenant_id"`
-	DeviceID   string  `json:"device_id"`
-	Timestamp  string  `json:"ts"`
-	Metrics    Metrics `json:"metrics"`
-	BatteryPct int     `json:"battery_pct"`
-	FWVersion  string  `json:"fw_version"`
-}
-
-type Metrics struct {
-	HeartRate int     `json:"hr_bpm"`
-	TempC     float64 `json:"temp_c"`
-	SpO2      int     `json:"spo2_pct"`
-	Steps     int     `json:"steps"`
-}
+func main() {
+	// "consumer replay [flags] <file>" feeds a DLQ file back through the
+	// pipeline instead of subscribing
+	replayMode := len(os.Args) > 1 && os.Args[1] == "replay"
+	args := os.Args[1:]
+	if replayMode {
+		args = os.Args[2:]
+	}
 
-// Add this function to push telemetry to API for WebSocket broadcast
-func pushToWebSocket(telemetry Telemetry) {
-	apiURL := "http://localhost:8080/api/v1/internal/broadcast"
-	
-	payload, err := json.Marshal(map[string]interface{}{
-		"type":      "telemetry",
-		"device_id": telemetry.DeviceID,
-		"tenant_id": telemetry.TenantID,
-		"timestamp": telemetry.Timestamp,
-		"data": map[string]interface{}{
-			"hr_bpm":      telemetry.Metrics.HeartRate,
-			"temp_c":      telemetry.Metrics.TempC,
-			"spo2_pct":    telemetry.Metrics.SpO2,
-			"steps":       telemetry.Metrics.Steps,
-			"battery_pct": telemetry.BatteryPct,
-		},
-	})
-	
+	// Settings come from the config file and environment; flags override them
+	configPath := config.PathFromArgs(args)
+	cfg, err := config.Load(configPath)
 	if err != nil {
-		log.Printf("Failed to marshal WebSocket payload: %v", err)
-		return
+		log.Fatalf("Failed to load config: %v", err)
 	}
-	
-	resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(payload))
-	if err != nil {
-		// Don't log errors - API might not be running, that's ok
-		return
+	if cfg.Consumer.ClientID == "" {
+		cfg.Consumer.ClientID = defaultClientID()
 	}
-	defer resp.Body.Close()
-}
 
-func main() {
 	// Flags
-	broker := flag.String("broker", "tcp://localhost:1883", "MQTT broker")
-	topic := flag.String("topic", "tenants/+/devices/+/telemetry", "MQTT topic pattern")
-	ddbEndpoint := flag.String("ddb-endpoint", "http://localhost:8000", "DynamoDB endpoint")
-	ddbTable := flag.String("ddb-table", "healthsense-telemetry-dev", "DynamoDB table")
-	redisAddr := flag.String("redis", "localhost:6379", "Redis address")
-	flag.Parse()
+	flag.String("config", configPath, "YAML config file (or set $"+config.PathEnv+")")
+	broker := flag.String("broker", cfg.MQTT.Broker, "MQTT broker")
+	topic := flag.String("topic", cfg.MQTT.Topic, "MQTT topic pattern")
+	shareGroup := flag.String("share-group", cfg.Consumer.ShareGroup, "Join this MQTT shared subscription group, splitting messages with the other consumers in it")
+	clientID := flag.String("client-id", cfg.Consumer.ClientID, "MQTT client ID; must be unique per consumer and stable across restarts")
+	storeKind := flag.String("store", cfg.Store, "Storage backend: dynamodb or timescale (both with Redis), or memory")
+	ddbEndpoint := flag.String("ddb-endpoint", cfg.AWS.DynamoDBEndpoint, "DynamoDB endpoint")
+	ddbTable := flag.String("ddb-table", cfg.AWS.DynamoDBTable, "DynamoDB table")
+	pgDSN := flag.String("pg-dsn", cfg.Postgres.DSN, "TimescaleDB connection string")
+	redisAddr := flag.String("redis", cfg.Redis.Addr, "Redis address")
+	apiAddr := flag.String("api", "", "Serve the API from this process on this address (e.g. :8080)")
+	batch := flag.Bool("batch", false, "Write to DynamoDB with buffered BatchWriteItem calls")
+	batchLinger := flag.Duration("batch-linger", 100*time.Millisecond, "Max time a partial batch waits before flushing")
+	batchFlushers := flag.Int("batch-flushers", 4, "Concurrent BatchWriteItem calls")
+	workers := flag.Int("workers", 8, "Workers processing messages; each device is always handled by the same worker")
+	queueDepth := flag.Int("queue-depth", 100, "Messages buffered per worker before MQTT delivery is held back")
+	dlqFile := flag.String("dlq-file", "consumer-dlq.ndjson", "Append rejected messages to this NDJSON file")
+	dlqTopic := flag.String("dlq-topic", "", "Publish rejected messages to this MQTT topic instead of -dlq-file")
+	persistAttempts := flag.Int("persist-attempts", 3, "Store attempts before a reading is dead-lettered")
+	stages := flag.String("stages", cfg.Consumer.Stages, "Pipeline stages to run, in order (notify needs -sns-topic-arn)")
+	snsTopicARN := flag.String("sns-topic-arn", cfg.AWS.SNSTopicARN, "SNS topic the notify stage sends anomaly alerts to")
+	spoolDir := flag.String("spool-dir", "consumer-spool", "Keep readings that fail to store in this directory until storage recovers (empty: dead-letter them)")
+	spoolInterval := flag.Duration("spool-interval", 10*time.Second, "How often to try writing spooled readings back to storage")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address (e.g. :9102)")
+	opTimeout := flag.Duration("op-timeout", 5*time.Second, "Timeout for each storage, cache and publish call")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "On shutdown, time allowed to finish in-flight messages before they are cancelled")
+	maxAttempts := flag.Int("replay-max-attempts", 10, "replay: leave entries with this many attempts in the DLQ")
+	inputPath := flag.String("input", "", "Process telemetry NDJSON from this file (- for stdin) instead of subscribing to MQTT")
+	pace := flag.String("pace", "fast", "-input: realtime, a speed-up such as 10x, or fast")
+	flag.CommandLine.Parse(args)
 
-	log.Println("Starting HealthSense Consumer")
+	// Replay and -input both run through their input and exit
+	inputMode := *inputPath != ""
+	offline := replayMode || inputMode
+	if replayMode && inputMode {
+		log.Fatalf("-input cannot be used with replay")
+	}
+	speed, err := parsePace(*pace)
+	if err != nil {
+		log.Fatalf("Invalid -pace: %v", err)
+	}
 
-	ctx := context.Background()
+	logging.SetLevel(cfg.LogLevel)
 
-	// Initialize DynamoDB
-	ddbClient, err := db.NewDynamoDBClient(ctx, *ddbEndpoint, "us-east-1", *ddbTable)
-	if err != nil {
-		log.Fatalf("Failed to create DynamoDB client: %v", err)
+	if replayMode {
+		log.Println("Starting HealthSense Consumer (DLQ replay)")
+	} else if inputMode {
+		log.Printf("Starting HealthSense Consumer (input: %s, pace: %s)", *inputPath, *pace)
+	} else {
+		log.Println("Starting HealthSense Consumer")
 	}
 
-	// Initialize Redis
-	redisClient, err := cache.NewRedisClient(*redisAddr)
+	subscription, err := subscriptionTopic(*shareGroup, *topic)
 	if err != nil {
-		log.Fatalf("Failed to create Redis client: %v", err)
+		log.Fatalf("Invalid subscription: %v", err)
 	}
-	defer redisClient.Close()
 
-	// Initialize anomaly detector
-	detector := anomaly.NewSimpleDetector()
+	ctx := context.Background()
 
-	// MQTT message handler
-	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
-		var telemetry Telemetry
-		if err := json.Unmarshal(msg.Payload(), &telemetry); err != nil {
-			log.Printf("Invalid JSON: %v", err)
-			return
+	// Read the entries to replay before the DLQ is reopened, moving the file
+	// aside if it is also the DLQ so entries that fail again start a new one
+	var replayEntries []dlq.Entry
+	if replayMode {
+		if flag.NArg() != 1 {
+			log.Fatalf("Usage: consumer replay [flags] <dlq-file>")
 		}
+		entries, err := readReplayFile(flag.Arg(0), *dlqFile, *dlqTopic == "")
+		if err != nil {
+			log.Fatalf("Failed to read DLQ: %v", err)
+		}
+		replayEntries = entries
+	}
 
-		log.Printf("[%s] HR:%d Temp:%.1f SpO2:%d",
-			telemetry.DeviceID,
-			telemetry.Metrics.HeartRate,
-			telemetry.Metrics.TempC,
-			telemetry.Metrics.SpO2,
-		)
+	// Recorded readings are validated against their own timeline
+	var input io.ReadCloser
+	clock := &inputClock{}
+	now := time.Now
+	if inputMode {
+		input, err = openInput(*inputPath)
+		if err != nil {
+			log.Fatalf("Failed to open input: %v", err)
+		}
+		now = clock.Now
+	}
 
-		// Detect anomalies
-		anomalyResult := detector.Detect(
-			telemetry.Metrics.HeartRate,
-			telemetry.Metrics.TempC,
-			telemetry.Metrics.SpO2,
-		)
+	var store db.Store
+	var latestCache cache.LatestCache
+	var detectorState interface {
+		anomaly.BaselineStore
+		anomaly.EpisodeStore
+	}
+	var bus pubsub.Bus
+	var dynamoClient *db.DynamoDBClient
 
-		if anomalyResult.IsAnomaly {
-			log.Printf("[%s] ANOMALY DETECTED: %s - %s",
-				telemetry.DeviceID,
-				anomalyResult.AnomalyType,
-				anomalyResult.Reason,
-			)
+	switch *storeKind {
+	case "dynamodb":
+		// Initialize DynamoDB
+		ddbClient, err := db.NewDynamoDBClient(ctx, *ddbEndpoint, cfg.AWS.Region, *ddbTable)
+		if err != nil {
+			log.Fatalf("Failed to create DynamoDB client: %v", err)
 		}
+		store = ddbClient
+		dynamoClient = ddbClient
 
-		// Store in DynamoDB
-		record := db.TelemetryRecord{
-			TenantID:    telemetry.TenantID,
-			DeviceID:    telemetry.DeviceID,
-			Timestamp:   telemetry.Timestamp,
-			HeartRate:   telemetry.Metrics.HeartRate,
-			TempC:       telemetry.Metrics.TempC,
-			SpO2:        telemetry.Metrics.SpO2,
-			Steps:       telemetry.Metrics.Steps,
-			BatteryPct:  telemetry.BatteryPct,
-			FWVersion:   telemetry.FWVersion,
-			AnomalyFlag: anomalyResult.IsAnomaly,
-			AnomalyType: anomalyResult.AnomalyType,
+	case "timescale":
+		// Initialize TimescaleDB
+		tsClient, err := timescale.NewClient(ctx, *pgDSN)
+		if err != nil {
+			log.Fatalf("Failed to create TimescaleDB client: %v", err)
 		}
+		defer tsClient.Close()
+		store = tsClient
+
+	case "memory":
+		log.Printf("Using in-memory store (data is lost on exit)")
+		store = db.NewMemoryStore()
+		memoryCache := cache.NewMemoryCache()
+		latestCache, detectorState = memoryCache, memoryCache
+		bus = pubsub.NewMemoryBus()
+
+	default:
+		log.Fatalf("Unknown store %q (expected dynamodb, timescale or memory)", *storeKind)
+	}
 
-		if err := ddbClient.PutTelemetry(ctx, record); err != nil {
-			log.Printf("Failed to store in DynamoDB: %v", err)
+	// Initialize Redis for the persistent backends
+	if latestCache == nil {
+		redisClient, err := cache.NewRedisClient(*redisAddr, cfg.Redis.Password)
+		if err != nil {
+			log.Fatalf("Failed to create Redis client: %v", err)
 		}
+		latestCache, detectorState = redisClient, redisClient
+	}
+	defer latestCache.Close()
 
-		// Cache in Redis
-		ts, _ := time.Parse(time.RFC3339, telemetry.Timestamp)
-		cacheData := cache.LatestTelemetry{
-			DeviceID:   telemetry.DeviceID,
-			Timestamp:  ts,
-			HeartRate:  telemetry.Metrics.HeartRate,
-			TempC:      telemetry.Metrics.TempC,
-			SpO2:       telemetry.Metrics.SpO2,
-			Steps:      telemetry.Metrics.Steps,
-			BatteryPct: telemetry.BatteryPct,
+	// Detector settings and the log level can be changed without a restart.
+	// Device baselines and episodes live with the latest readings, in Redis
+	// or memory.
+	detector := anomaly.NewSimpleDetector()
+	baseline := anomaly.NewBaselineDetector(detectorState, cfg.Detector.BaselineSettings())
+	sustain := anomaly.NewSustainedDetector(detectorState, detector, cfg.Detector.SustainSettings())
+	applyReloadable := func(cfg *config.Config) {
+		logging.SetLevel(cfg.LogLevel)
+		if err := cfg.Detector.Apply(detector); err != nil {
+			log.Printf("Failed to apply detector settings: %v", err)
 		}
+		baseline.SetSettings(cfg.Detector.BaselineSettings())
+		sustain.SetSettings(cfg.Detector.SustainSettings())
+	}
+	applyReloadable(cfg)
+	config.OnReload(configPath, applyReloadable)
 
-		if err := redisClient.SetLatest(ctx, telemetry.TenantID, telemetry.DeviceID, cacheData); err != nil {
-			log.Printf("Failed to cache in Redis: %v", err)
+	// Live updates are published to every API instance over Redis pub/sub,
+	// or in process in memory mode
+	if bus == nil {
+		redisBus, err := pubsub.NewRedisBus(*redisAddr, cfg.Redis.Password)
+		if err != nil {
+			log.Fatalf("Failed to create Redis pub/sub: %v", err)
 		}
+		bus = redisBus
+	}
+	defer bus.Close()
 
-		// Push to WebSocket
-		pushToWebSocket(telemetry)
+	if *apiAddr != "" && !replayMode {
+		server := api.NewServer(store, latestCache, bus, cfg.API.CORSOrigins)
+		go func() {
+			if err := server.Start(*apiAddr); err != nil {
+				log.Fatalf("Server failed: %v", err)
+			}
+		}()
 	}
 
-	// Connect to MQTT
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(*broker)
-	opts.SetClientID("consumer-main")
-	opts.SetDefaultPublishHandler(messageHandler)
-	opts.SetAutoReconnect(true)
+	proc := &processor{
+		store:     store,
+		opTimeout: *opTimeout,
+	}
 
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatalf("Failed to connect: %v", token.Error())
+	// Readings that fail to store wait on disk until storage recovers
+	if *spoolDir != "" {
+		readingSpool, err := spool.Open(*spoolDir, spool.DefaultSegmentBytes)
+		if err != nil {
+			log.Fatalf("Failed to open spool: %v", err)
+		}
+		proc.spool = readingSpool
+		log.Printf("Spooling failed writes to %s (%d readings waiting)", *spoolDir, readingSpool.Depth())
 	}
 
-	log.Printf("Connected to MQTT broker")
+	if *batch && dynamoClient != nil {
+		proc.batchWriter = db.NewBatchWriter(dynamoClient, db.BatchWriterConfig{
+			MaxLinger:  *batchLinger,
+			MaxRetries: batchRetries,
+			Flushers:   *batchFlushers,
+			OnFailure: func(record db.TelemetryRecord, events []db.AnomalyEvent, attempts int, err error) {
+				log.Printf("[%s] Failed to store reading %s: %v", record.DeviceID, record.Timestamp, err)
+				if !proc.spoolReading(record, events) {
+					proc.deadLetterRecord(record, attempts, err)
+				}
+			},
+		})
+		log.Printf("Batch writes enabled (linger: %v, flushers: %d)", *batchLinger, *batchFlushers)
+	} else if *batch {
+		log.Printf("-batch only applies to the dynamodb store, writing synchronously")
+	}
 
-	// Subscribe
-	if token := client.Subscribe(*topic, 1, nil); token.Wait() && token.Error() != nil {
-		log.Fatalf("Failed to subscribe: %v", token.Error())
+	var notifier pipeline.Notifier
+	if *snsTopicARN != "" {
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.AWS.Region))
+		if err != nil {
+			log.Fatalf("Unable to load AWS config: %v", err)
+		}
+		notifier = pipeline.NewSNSNotifier(sns.NewFromConfig(awsCfg), *snsTopicARN)
 	}
 
-	log.Printf("Subscribed to: %s", *topic)
-	log.Println("Listening for telemetry...")
+	// The same stages run in the Lambda processor, so readings are handled
+	// alike locally and in AWS
+	proc.pipeline, err = pipeline.Build(pipeline.ParseStages(*stages), pipeline.Deps{
+		Registry: store,
+		Detector: detector,
+		Baseline: baseline,
+		Sustain:  sustain,
+		Scorer:   anomaly.NewNEWS2Scorer(),
+		Store:    store,
+		Cache:    latestCache,
+		Notifier: notifier,
+		Bus:      bus,
+		Persist: pipeline.PersistOptions{
+			Attempts:  *persistAttempts,
+			Batch:     proc.batchWriter,
+			OnFailure: proc.persistFailed,
+		},
+		Timeout: *opTimeout,
+		Now:     now,
+	})
+	if err != nil {
+		log.Fatalf("Invalid pipeline: %v", err)
+	}
+	log.Printf("Pipeline: %s", strings.Join(proc.pipeline.Stages(), " -> "))
 
-	// Wait for interrupt
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	// The MQTT callback only hands messages to the pool, so a slow dependency
+	// holds up one worker's devices instead of the whole subscription
+	// Processing has its own context, cancelled if shutdown runs out of time
+	procCtx, cancelProc := context.WithCancel(ctx)
+	defer cancelProc()
 
-	log.Println("Shutting down...")
-	client.Disconnect(250)
-}
+	pool := newWorkerPool(*workers, *queueDepth, func(msg inbound) {
+		proc.handle(procCtx, msg)
+	})
+	log.Printf("Worker pool started (workers: %d, queue depth: %d)", *workers, *queueDepth)
+
+	// Look for devices that stop reporting; replay and -input have no live
+	// devices to watch
+	if monitor := proc.pipeline.StaleMonitor(); monitor != nil && !offline {
+		if err := monitor.Seed(procCtx, cfg.Detector.StaleTenants); err != nil {
+			log.Printf("Failed to load registered devices to watch: %v", err)
+		}
+		go monitor.Run(procCtx, cfg.Detector.ReadingInterval)
+	}
+
+	// Write spooled readings back while the consumer runs
+	spoolCtx, stopSpool := context.WithCancel(procCtx)
+	spoolDone := make(chan struct{})
+	if proc.spool != nil && !offline {
+		go func() {
+			defer close(spoolDone)
+			proc.drainSpool(spoolCtx, *spoolInterval)
+		}()
+	} else {
+		close(spoolDone)
+	}
+
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr, proc, pool)
+		log.Printf("Metrics on http://%s/metrics", *metricsAddr)
+	}
+
+	// Create the MQTT client, which replay and -input only need for a DLQ
+	// topic
+	var client mqtt.Client
+	if !offline || *dlqTopic != "" {
+		opts := mqtt.NewClientOptions()
+		opts.AddBroker(*broker)
+		opts.SetAutoReconnect(true)
+
+		if replayMode {
+			opts.SetClientID(*clientID + "-replay")
+		} else if inputMode {
+			opts.SetClientID(*clientID + "-input")
+		} else {
+			// A persistent session keeps the subscription, and queues
+			// messages for it, while the consumer is restarting
+			opts.SetClientID(*clientID)
+			opts.SetCleanSession(false)
 
+			// Messages are only acknowledged once the pool has taken them,
+			// so any that arrive during shutdown are redelivered instead
+			opts.SetAutoAckDisabled(true)
+			opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+				if !pool.Submit(inbound{topic: msg.Topic(), payload: msg.Payload()}) {
+					log.Printf("Leaving message on %s for redelivery, shutting down", msg.Topic())
+					return
+				}
+				msg.Ack()
+			})
+
+			// Subscribe on every connect, which restores the subscription if
+			// the broker dropped the session
+			opts.SetOnConnectHandler(func(client mqtt.Client) {
+				if token := client.Subscribe(subscription, 1, nil); token.Wait() && token.Error() != nil {
+					log.Printf("Failed to subscribe to %s: %v", subscription, token.Error())
+					return
+				}
+				log.Printf("Subscribed to: %s", subscription)
+			})
+		}
+
+		client = mqtt.NewClient(opts)
+	}
+
+	// Rejected messages go to the DLQ topic or file. The sink must be ready
+	// before connecting, since a resumed session delivers queued messages
+	// straight away.
+	if *dlqTopic != "" {
+		proc.deadLetters = dlq.NewMQTTSink(client, *dlqTopic)
+		log.Printf("Dead-lettering to MQTT topic %s", *dlqTopic)
+	} else {
+		sink, err := dlq.NewFileSink(*dlqFile)
+		if err != nil {
+			log.Fatalf("Failed to open DLQ: %v", err)
+		}
+		proc.deadLetters = sink
+		log.Printf("Dead-lettering to %s", *dlqFile)
+	}
+	defer proc.deadLetters.Close()
+
+	if client != nil {
+		if token := client.Connect(); token.Wait() && token.Error() != nil {
+			log.Fatalf("Failed to connect: %v", token.Error())
+		}
+		reader := client.OptionsReader()
+		log.Printf("Connected to MQTT broker as %s", reader.ClientID())
+	}
+
+	var lost int64
+	if replayMode {
+		replay(pool, replayEntries, *maxAttempts, proc.deadLetters)
+		pool.Close()
+		if proc.batchWriter != nil {
+			proc.batchWriter.Close()
+		}
+	} else if inputMode {
+		// An interrupt stops reading; readings already read are finished
+		inputCtx, stopInput := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		submitted, err := feedInput(inputCtx, pool, input, speed, clock)
+		stopInput()
+		input.Close()
+		if err != nil {
+			log.Printf("Stopped reading input after %d readings: %v", submitted, err)
+		} else {
+			log.Printf("Read %d readings from %s", submitted, *inputPath)
+		}
+
+		pool.Close()
+		if proc.batchWriter != nil {
+			proc.batchWriter.Close()
+		}
+	} else {
+		go func() {
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				log.Printf("Stats: %s, %d queued", proc.summary(), pool.Queued())
+			}
+		}()
+
+		log.Println("Listening for telemetry...")
+
+		// Wait for interrupt
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		<-sigChan
+
+		// Stop taking messages, which leaves new ones unacknowledged for
+		// redelivery, and finish the ones already taken. Stay subscribed, so
+		// the broker keeps queueing messages for this session, and connected,
+		// so readings still in the pipeline can be dead-lettered to a topic.
+		log.Printf("Shutting down, draining %d messages (deadline %v)...", pool.Pending(), *drainTimeout)
+		stopSpool()
+		<-spoolDone
+		lost = drain(pool, proc.batchWriter, *drainTimeout, cancelProc)
+	}
+	stopSpool()
+
+	if proc.spool != nil {
+		proc.spool.Close()
+	}
+
+	if proc.batchWriter != nil {
+		written, failed := proc.batchWriter.Stats()
+		log.Printf("Batch writer flushed (written: %d, failed: %d, duplicates: %d)", written, failed, proc.batchWriter.Duplicates())
+	}
+
+	if client != nil {
+		client.Disconnect(250)
+	}
+
+	log.Printf("Shutdown complete: %s, %d lost", proc.summary(), proc.lost.Load()+lost)
+}
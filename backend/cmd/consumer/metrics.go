@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// serveMetrics exposes the consumer's counters and spool state in the
+// Prometheus text format on addr
+func serveMetrics(addr string, proc *processor, pool *workerPool) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		processed, duplicates := proc.stored()
+		writeMetric(w, "processed_total", "counter", "Readings stored", float64(processed))
+		writeMetric(w, "duplicates_total", "counter", "Redelivered readings skipped", float64(duplicates))
+		writeMetric(w, "rejected_total", "counter", "Readings that failed validation", float64(proc.rejected.Load()))
+		writeMetric(w, "dead_lettered_total", "counter", "Messages written to the DLQ", float64(proc.deadLettered.Load()))
+		writeMetric(w, "lost_total", "counter", "Messages that could not be stored, spooled or dead-lettered", float64(proc.lost.Load()))
+		writeMetric(w, "pending", "gauge", "Messages taken from MQTT and not yet handled", float64(pool.Pending()))
+
+		var depth int64
+		var age float64
+		if proc.spool != nil {
+			depth = proc.spool.Depth()
+			if oldest := proc.spool.Oldest(); !oldest.IsZero() {
+				age = time.Since(oldest).Seconds()
+			}
+		}
+		writeMetric(w, "spooled_total", "counter", "Readings spooled after a failed write", float64(proc.spooled.Load()))
+		writeMetric(w, "spool_recovered_total", "counter", "Spooled readings written back to storage", float64(proc.recovered.Load()))
+		writeMetric(w, "spool_depth", "gauge", "Readings waiting in the spool", float64(depth))
+		writeMetric(w, "spool_oldest_age_seconds", "gauge", "Age of the oldest reading in the spool", age)
+	})
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Metrics server failed: %v", err)
+		}
+	}()
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	name = "healthsense_consumer_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultClientID is stable across restarts, so the broker resumes the
+// consumer's session, and differs between hosts. Instances sharing a host
+// need -client-id.
+func defaultClientID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "healthsense-consumer"
+	}
+	return "healthsense-consumer-" + host
+}
+
+// subscriptionTopic returns the filter to subscribe with. With a group it is
+// an MQTT shared subscription, which the broker load-balances across all
+// consumers in the group.
+func subscriptionTopic(group, topic string) (string, error) {
+	if group == "" {
+		return topic, nil
+	}
+	if strings.ContainsAny(group, "/+#") {
+		return "", fmt.Errorf("share group %q must not contain '/', '+' or '#'", group)
+	}
+	return "$share/" + group + "/" + topic, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/dlq"
+	"github.com/meghanan266/healthsense/backend/pkg/pipeline"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+	"github.com/meghanan266/healthsense/backend/pkg/spool"
+)
+
+// inbound is a raw message waiting to be processed
+type inbound struct {
+	topic    string
+	payload  []byte
+	attempts int  // Attempts already made, for messages replayed from the DLQ
+	replay   bool // Replayed messages are stored but not cached or published
+}
+
+// processor runs each message through the pipeline and accounts for the
+// outcome. Messages that cannot be decoded, fail validation or cannot be
+// stored go to the DLQ.
+type processor struct {
+	pipeline    *pipeline.Pipeline
+	store       db.Store        // Used to write back spooled readings
+	batchWriter *db.BatchWriter // Optional; writes go straight to store when nil
+	deadLetters dlq.Sink
+	opTimeout   time.Duration // Limit for each storage call outside the pipeline
+
+	processed    atomic.Int64
+	duplicates   atomic.Int64
+	rejected     atomic.Int64
+	deadLettered atomic.Int64
+	lost         atomic.Int64 // Messages that could not even be dead-lettered
+
+	spool     *spool.Spool // Optional; failed writes go to the DLQ when nil
+	spooled   atomic.Int64
+	recovered atomic.Int64
+}
+
+// withTimeout bounds a single call to a dependency
+func (p *processor) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.opTimeout)
+}
+
+// handle processes a single message
+func (p *processor) handle(ctx context.Context, in inbound) {
+	msg := &pipeline.Message{
+		Topic:    in.topic,
+		Payload:  in.payload,
+		Attempts: in.attempts,
+		Replay:   in.replay,
+	}
+
+	err := p.pipeline.Process(ctx, msg)
+	switch {
+	case err == nil:
+		// Batched readings are counted once the batch writer has written them
+		if msg.Stored && p.batchWriter == nil {
+			p.processed.Add(1)
+		}
+
+	case errors.Is(err, db.ErrDuplicateReading):
+		// A QoS 1 redelivery; it was fully handled the first time
+		p.duplicates.Add(1)
+		log.Printf("[%s] Ignoring duplicate: %v", msg.Telemetry.DeviceID, err)
+
+	case pipeline.FailedAt(err, pipeline.StageDecode):
+		log.Printf("Invalid message on %s: %v", in.topic, err)
+		p.deadLetter(in.topic, in.payload, dlq.StageDecode, err, in.attempts+1)
+
+	case pipeline.FailedAt(err, pipeline.StageValidate):
+		p.rejected.Add(1)
+		log.Printf("Rejected reading on %s: %v", in.topic, err)
+		p.deadLetter(in.topic, in.payload, dlq.StageValidate, err, in.attempts+1)
+
+	default:
+		log.Printf("Failed to process message on %s: %v", in.topic, err)
+	}
+}
+
+// persistFailed takes over a reading the pipeline could not store, spooling
+// it or, failing that, sending it to the DLQ
+func (p *processor) persistFailed(msg *pipeline.Message, attempts int, err error) {
+	if !p.spoolReading(msg.Record, msg.Events) {
+		p.deadLetter(msg.Topic, msg.Payload, dlq.StagePersist, err, msg.Attempts+attempts)
+	}
+}
+
+// stored returns the number of readings stored and of duplicates skipped,
+// including those handled by the batch writer
+func (p *processor) stored() (processed, duplicates int64) {
+	processed, duplicates = p.processed.Load(), p.duplicates.Load()
+	if p.batchWriter != nil {
+		written, _ := p.batchWriter.Stats()
+		processed += written
+		duplicates += p.batchWriter.Duplicates()
+	}
+	return processed, duplicates
+}
+
+// summary describes the counters for logging
+func (p *processor) summary() string {
+	processed, duplicates := p.stored()
+
+	summary := fmt.Sprintf("%d processed, %d duplicates, %d rejected, %d dead-lettered",
+		processed, duplicates, p.rejected.Load(), p.deadLettered.Load())
+	if p.spool != nil {
+		summary += fmt.Sprintf(", %d spooled, %d recovered from spool, %d in spool",
+			p.spooled.Load(), p.recovered.Load(), p.spool.Depth())
+	}
+	return summary
+}
+
+// deadLetterRecord sends a reading the batch writer gave up on to the DLQ.
+// The original payload is no longer available, so it is rebuilt from the
+// record.
+func (p *processor) deadLetterRecord(record db.TelemetryRecord, attempts int, err error) {
+	payload, marshalErr := json.Marshal(schema.Telemetry{
+		TenantID:  record.TenantID,
+		DeviceID:  record.DeviceID,
+		Timestamp: record.Timestamp,
+		Metrics: schema.Metrics{
+			HeartRate: record.HeartRate,
+			TempC:     record.TempC,
+			SpO2:      record.SpO2,
+			Steps:     record.Steps,
+		},
+		BatteryPct: record.BatteryPct,
+		FWVersion:  record.FWVersion,
+		MessageID:  record.MessageID,
+		Seq:        record.Seq,
+	})
+	if marshalErr != nil {
+		log.Printf("[%s] Failed to encode reading %s for the DLQ: %v", record.DeviceID, record.Timestamp, marshalErr)
+		return
+	}
+
+	topic := fmt.Sprintf("tenants/%s/devices/%s/telemetry", record.TenantID, record.DeviceID)
+	p.deadLetter(topic, payload, dlq.StagePersist, err, attempts)
+}
+
+func (p *processor) deadLetter(topic string, payload []byte, stage string, err error, attempts int) {
+	entry := dlq.Entry{
+		Topic:    topic,
+		Payload:  payload,
+		Stage:    stage,
+		Error:    err.Error(),
+		Attempts: attempts,
+	}
+	if err := p.deadLetters.Write(entry); err != nil {
+		p.lost.Add(1)
+		log.Printf("Failed to dead-letter message on %s, it is lost: %v (payload: %s)", topic, err, payload)
+		return
+	}
+	p.deadLettered.Add(1)
+}
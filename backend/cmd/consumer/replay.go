@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/dlq"
+)
+
+// batchRetries is how often the batch writer retries before a reading is
+// dead-lettered
+const batchRetries = 5
+
+// readReplayFile loads the entries to replay. When the file is also the
+// active DLQ file it is renamed first, so entries that fail again are written
+// to a fresh DLQ file instead of the one being replayed.
+func readReplayFile(path, dlqFile string, fileSink bool) ([]dlq.Entry, error) {
+	if fileSink && samePath(path, dlqFile) {
+		moved := fmt.Sprintf("%s.%s.replayed", path, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(path, moved); err != nil {
+			return nil, fmt.Errorf("failed to move DLQ file aside: %w", err)
+		}
+		log.Printf("Moved %s to %s for replay", path, moved)
+		path = moved
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	return dlq.ReadEntries(file)
+}
+
+// replay submits DLQ entries to the pool in file order. Entries that have
+// already used up their attempts are written back to the DLQ untouched.
+func replay(pool *workerPool, entries []dlq.Entry, maxAttempts int, deadLetters dlq.Sink) {
+	log.Printf("Replaying %d DLQ entries", len(entries))
+
+	skipped := 0
+	for _, entry := range entries {
+		if entry.Attempts >= maxAttempts {
+			skipped++
+			if err := deadLetters.Write(entry); err != nil {
+				log.Printf("Failed to keep DLQ entry for %s: %v", entry.Topic, err)
+			}
+			continue
+		}
+
+		pool.Submit(inbound{
+			topic:    entry.Topic,
+			payload:  entry.Payload,
+			attempts: entry.Attempts,
+			replay:   true,
+		})
+	}
+
+	if skipped > 0 {
+		log.Printf("Kept %d entries that reached %d attempts", skipped, maxAttempts)
+	}
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// abortGrace is how long cancelled work gets to fail, and be dead-lettered,
+// once the drain deadline has passed
+const abortGrace = 5 * time.Second
+
+// drain stops the pool accepting messages and waits for everything it has
+// accepted to be stored or dead-lettered, including batched writes. If that
+// takes longer than timeout, in-flight work is cancelled through cancel and
+// given abortGrace to wind down. It returns the number of messages still
+// unaccounted for, which are lost.
+func drain(pool *workerPool, batchWriter *db.BatchWriter, timeout time.Duration, cancel context.CancelFunc) int64 {
+	ctx, stop := context.WithTimeout(context.Background(), timeout)
+	defer stop()
+
+	if drainWork(ctx, pool, batchWriter) == nil {
+		return 0
+	}
+
+	log.Printf("Drain did not finish within %v (%d messages pending), cancelling in-flight work", timeout, pool.Pending())
+	cancel()
+
+	graceCtx, stopGrace := context.WithTimeout(context.Background(), abortGrace)
+	defer stopGrace()
+
+	if drainWork(graceCtx, pool, batchWriter) == nil {
+		return 0
+	}
+
+	pending := pool.Pending()
+	if batchWriter != nil {
+		pending += batchWriter.Pending()
+	}
+	log.Printf("Gave up waiting for %d messages", pending)
+	return pending
+}
+
+func drainWork(ctx context.Context, pool *workerPool, batchWriter *db.BatchWriter) error {
+	if err := pool.Drain(ctx); err != nil {
+		return err
+	}
+	if batchWriter != nil {
+		return batchWriter.CloseContext(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/spool"
+)
+
+// spoolReading keeps a reading that could not be stored, and its anomaly
+// events, until storage recovers. It reports false if the reading still
+// needs to be dead-lettered.
+func (p *processor) spoolReading(record db.TelemetryRecord, events []db.AnomalyEvent) bool {
+	if p.spool == nil {
+		return false
+	}
+
+	if err := p.spool.Append(spool.Entry{Record: record, Anomalies: events}); err != nil {
+		log.Printf("[%s] Failed to spool reading %s: %v", record.DeviceID, record.Timestamp, err)
+		return false
+	}
+
+	p.spooled.Add(1)
+	return true
+}
+
+// drainSpool writes spooled readings back to storage, in timestamp order,
+// whenever the spool is not empty. A drain stops at the first failure, so
+// storage that is still down costs one write attempt per interval.
+func (p *processor) drainSpool(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if p.spool.Depth() == 0 {
+			continue
+		}
+
+		written, err := p.spool.Drain(ctx, func(entry spool.Entry) error {
+			return p.storeSpooled(ctx, entry)
+		})
+		if written > 0 {
+			p.recovered.Add(int64(written))
+			log.Printf("Recovered %d readings from the spool (%d left)", written, p.spool.Depth())
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Spool drain stopped, retrying in %v: %v", interval, err)
+		}
+	}
+}
+
+// storeSpooled writes one spooled reading and its anomaly events. Writing
+// the reading again is harmless, so an entry is only done once all succeed.
+func (p *processor) storeSpooled(ctx context.Context, entry spool.Entry) error {
+	putCtx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	// A duplicate was stored by an earlier attempt that timed out late
+	if err := p.store.PutTelemetry(putCtx, entry.Record); err != nil && !errors.Is(err, db.ErrDuplicateReading) {
+		return err
+	}
+
+	for _, event := range entry.Anomalies {
+		anomalyCtx, cancel := p.withTimeout(ctx)
+		err := p.store.PutAnomaly(anomalyCtx, event)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to store %s anomaly: %w", event.AnomalyType, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+// workerPool processes messages on a fixed number of workers, each with its
+// own bounded queue. Messages are sharded by device, so readings from one
+// device are handled in arrival order while different devices run in
+// parallel.
+type workerPool struct {
+	mu     sync.RWMutex // guards closed against sends on queues
+	closed bool
+	queues []chan inbound
+	handle func(inbound)
+	wg     sync.WaitGroup
+
+	accepted atomic.Int64
+	handled  atomic.Int64
+}
+
+// newWorkerPool starts workers that each buffer up to depth messages
+func newWorkerPool(workers, depth int, handle func(inbound)) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if depth < 1 {
+		depth = 1
+	}
+
+	p := &workerPool{
+		queues: make([]chan inbound, workers),
+		handle: handle,
+	}
+
+	for i := range p.queues {
+		p.queues[i] = make(chan inbound, depth)
+		p.wg.Add(1)
+		go p.run(p.queues[i])
+	}
+
+	return p
+}
+
+// Submit queues a message on its device's worker. It blocks while that
+// worker's queue is full, which holds up the MQTT client's delivery of further
+// messages until the worker catches up. It reports false if the pool has been
+// closed.
+func (p *workerPool) Submit(msg inbound) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	p.queues[p.shard(msg.topic)] <- msg
+	p.accepted.Add(1)
+	return true
+}
+
+// Queued returns the number of messages waiting across all workers
+func (p *workerPool) Queued() int {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Pending returns the number of accepted messages not yet fully handled,
+// whether queued or in progress
+func (p *workerPool) Pending() int64 {
+	return p.accepted.Load() - p.handled.Load()
+}
+
+// Drain is Close with a deadline. It returns ctx's error if the messages are
+// not all handled in time; the workers carry on in the background.
+func (p *workerPool) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be handled
+func (p *workerPool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, q := range p.queues {
+			close(q)
+		}
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *workerPool) run(queue <-chan inbound) {
+	defer p.wg.Done()
+	for msg := range queue {
+		p.handle(msg)
+		p.handled.Add(1)
+	}
+}
+
+// shard picks a worker from the tenant and device segments of a
+// tenants/{tenant}/devices/{device}/telemetry topic. Other topics are sharded
+// on the whole topic name.
+func (p *workerPool) shard(topic string) int {
+	key := topic
+	if tenant, device, ok := schema.ParseTopic(topic); ok {
+		key = tenant + "/" + device
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		depth   int
+		devices int
+	}{
+		{name: "single worker", workers: 1, depth: 4, devices: 3},
+		{name: "more devices than workers", workers: 4, depth: 2, devices: 10},
+		{name: "more workers than devices", workers: 8, depth: 1, devices: 2},
+		{name: "invalid sizes default to one", workers: 0, depth: 0, devices: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			handled := make(map[string][]int) // topic -> payload sequence
+			pool := newWorkerPool(tt.workers, tt.depth, func(msg inbound) {
+				var seq int
+				fmt.Sscan(string(msg.payload), &seq)
+				mu.Lock()
+				handled[msg.topic] = append(handled[msg.topic], seq)
+				mu.Unlock()
+			})
+
+			// Interleave the devices' readings as they would arrive
+			const perDevice = 50
+			for seq := 0; seq < perDevice; seq++ {
+				for d := 0; d < tt.devices; d++ {
+					topic := fmt.Sprintf("tenants/acme-clinic/devices/patient-%03d/telemetry", d)
+					if !pool.Submit(inbound{topic: topic, payload: []byte(fmt.Sprint(seq))}) {
+						t.Fatal("Submit rejected a message before Close")
+					}
+				}
+			}
+			pool.Close()
+
+			if pending := pool.Pending(); pending != 0 {
+				t.Errorf("%d messages pending after Close", pending)
+			}
+			if len(handled) != tt.devices {
+				t.Fatalf("handled %d devices, want %d", len(handled), tt.devices)
+			}
+
+			want := make([]int, perDevice)
+			for i := range want {
+				want[i] = i
+			}
+			for topic, got := range handled {
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s handled in order %v, want %v", topic, got, want)
+				}
+			}
+
+			if pool.Submit(inbound{topic: "tenants/acme-clinic/devices/patient-000/telemetry"}) {
+				t.Error("Submit accepted a message after Close")
+			}
+		})
+	}
+}
+
+func TestWorkerPoolShard(t *testing.T) {
+	pool := newWorkerPool(16, 1, func(inbound) {})
+	defer pool.Close()
+
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "same device, different suffix", a: "tenants/acme-clinic/devices/patient-001/telemetry", b: "tenants/acme-clinic/devices/patient-001/status"},
+		{name: "other topic", a: "legacy/telemetry", b: "legacy/telemetry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := pool.shard(tt.a), pool.shard(tt.b); a != b {
+				t.Errorf("%s on worker %d, %s on worker %d", tt.a, a, tt.b, b)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	pool := newWorkerPool(1, 1, func(inbound) {
+		started <- struct{}{}
+		<-release
+	})
+
+	msg := inbound{topic: "tenants/acme-clinic/devices/patient-001/telemetry"}
+	pool.Submit(msg) // Taken by the worker, which blocks
+	<-started
+	pool.Submit(msg) // Fills the queue
+
+	submitted := make(chan struct{})
+	go func() {
+		pool.Submit(msg)
+		close(submitted)
+	}()
+
+	select {
+	case <-submitted:
+		t.Fatal("Submit did not block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if got := pool.Queued(); got != 1 {
+		t.Errorf("%d queued, want 1", got)
+	}
+
+	close(release)
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("Submit still blocked after the worker caught up")
+	}
+
+	pool.Close()
+	if pending := pool.Pending(); pending != 0 {
+		t.Errorf("%d messages pending after Close", pending)
+	}
+}
@@ -3,231 +3,188 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/config"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/logging"
+	"github.com/meghanan266/healthsense/backend/pkg/pipeline"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
 )
 
-// Telemetry represents device sensor data
-type Telemetry struct {
-	TenantID   string  `json:"tenant_id"`
-	DeviceID   string  `json:"device_id"`
-	Timestamp  string  `json:"ts"`
-	Metrics    Metrics `json:"metrics"`
-	BatteryPct int     `json:"battery_pct"`
-	FWVersion  string  `json:"fw_version"`
-}
-
-type Metrics struct {
-	HeartRate int     `json:"hr_bpm"`
-	TempC     float64 `json:"temp_c"`
-	SpO2      int     `json:"spo2_pct"`
-	Steps     int     `json:"steps"`
-}
-
-type AnomalyResult struct {
-	IsAnomaly   bool
-	AnomalyType string
-	Reason      string
-}
+// defaultStages leaves out cache and publish, which need REDIS_ADDR
+const defaultStages = "decode,validate,enrich,detect,persist,notify"
 
 var (
-	ddbClient   *dynamodb.Client
-	snsClient   *sns.Client
+	proc        *pipeline.Pipeline
 	tableName   string
 	snsTopicARN string
-	hrThreshold float64 = 150.0
-	tempThreshold float64 = 38.0
+
+	// Stale devices are found by a scheduled check against the latest cache,
+	// since no one invocation sees every device's readings
+	staleChecks  bool
+	staleTenants []string
 )
 
 func init() {
 	// Load configuration from environment
 	tableName = os.Getenv("DDB_TABLE")
 	snsTopicARN = os.Getenv("SNS_TOPIC_ARN")
-	
+	redisAddr := os.Getenv("REDIS_ADDR")
+	stages := os.Getenv("PIPELINE_STAGES")
+	if stages == "" {
+		stages = defaultStages
+	}
+
 	if tableName == "" {
 		log.Fatal("DDB_TABLE environment variable not set")
 	}
 	if snsTopicARN == "" {
 		log.Fatal("SNS_TOPIC_ARN environment variable not set")
 	}
-	
+
+	// Thresholds and the log level use the same HEALTHSENSE_* variables as
+	// the other commands
+	settings, err := config.Load(os.Getenv(config.PathEnv))
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	logging.SetLevel(settings.LogLevel)
+
+	detector := anomaly.NewSimpleDetector()
+	if err := settings.Detector.Apply(detector); err != nil {
+		log.Fatalf("Invalid detector settings: %v", err)
+	}
+
 	// Initialize AWS clients
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := awsconfig.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		log.Fatalf("Unable to load AWS config: %v", err)
 	}
-	
-	ddbClient = dynamodb.NewFromConfig(cfg)
-	snsClient = sns.NewFromConfig(cfg)
-	
-	log.Printf("Lambda initialized - Table: %s, SNS: %s", tableName, snsTopicARN)
-}
 
-func handler(ctx context.Context, kinesisEvent events.KinesisEvent) error {
-	log.Printf("Processing %d records", len(kinesisEvent.Records))
-	
-	for _, record := range kinesisEvent.Records {
-		// Parse telemetry
-		var telemetry Telemetry
-		if err := json.Unmarshal(record.Kinesis.Data, &telemetry); err != nil {
-			log.Printf("❌ Failed to unmarshal record: %v", err)
-			continue
-		}
-		
-		log.Printf("📥 [%s] HR:%d Temp:%.1f SpO2:%d", 
-			telemetry.DeviceID,
-			telemetry.Metrics.HeartRate,
-			telemetry.Metrics.TempC,
-			telemetry.Metrics.SpO2,
-		)
-		
-		// Detect anomalies
-		anomaly := detectAnomaly(telemetry)
-		
-		if anomaly.IsAnomaly {
-			log.Printf("⚠️  [%s] ANOMALY: %s - %s", 
-				telemetry.DeviceID, 
-				anomaly.AnomalyType, 
-				anomaly.Reason,
-			)
-			
-			// Send SNS alert
-			if err := sendAlert(ctx, telemetry, anomaly); err != nil {
-				log.Printf("❌ Failed to send alert: %v", err)
-			}
+	store := db.NewDynamoDBClientFromConfig(cfg, tableName)
+	deps := pipeline.Deps{
+		Registry: store,
+		Detector: detector,
+		Scorer:   anomaly.NewNEWS2Scorer(),
+		Store:    store,
+		Notifier: pipeline.NewSNSNotifier(sns.NewFromConfig(cfg), snsTopicARN),
+	}
+
+	// The latest-reading cache, device baselines and live updates are
+	// optional here. Without Redis, episodes are kept per Lambda instance.
+	if redisAddr == "" {
+		deps.Sustain = anomaly.NewSustainedDetector(cache.NewMemoryCache(), detector, settings.Detector.SustainSettings())
+	} else {
+		redisClient, err := cache.NewRedisClient(redisAddr, settings.Redis.Password)
+		if err != nil {
+			log.Fatalf("Failed to create Redis client: %v", err)
 		}
-		
-		// Store in DynamoDB
-		if err := storeTelemetry(ctx, telemetry, anomaly); err != nil {
-			log.Printf("❌ Failed to store telemetry: %v", err)
-			return err // Return error to retry
+		deps.Cache = redisClient
+		deps.Baseline = anomaly.NewBaselineDetector(redisClient, settings.Detector.BaselineSettings())
+		deps.Sustain = anomaly.NewSustainedDetector(redisClient, detector, settings.Detector.SustainSettings())
+
+		bus, err := pubsub.NewRedisBus(redisAddr, settings.Redis.Password)
+		if err != nil {
+			log.Fatalf("Failed to create Redis pub/sub: %v", err)
 		}
+		deps.Bus = bus
 	}
-	
-	log.Printf("✅ Successfully processed %d records", len(kinesisEvent.Records))
-	return nil
+
+	// Without an OnFailure hook a failed write fails the batch, which
+	// Kinesis then retries
+	proc, err = pipeline.Build(pipeline.ParseStages(stages), deps)
+	if err != nil {
+		log.Fatalf("Invalid PIPELINE_STAGES: %v", err)
+	}
+
+	staleTenants = settings.Detector.StaleTenants
+	staleChecks = proc.StaleMonitor() != nil && deps.Cache != nil && hasStage(proc.Stages(), pipeline.StageCache)
+	if !staleChecks {
+		log.Printf("Stale devices are not checked: that needs REDIS_ADDR and the detect and cache stages")
+	}
+
+	log.Printf("Lambda initialized - Table: %s, SNS: %s, Pipeline: %s", tableName, snsTopicARN, strings.Join(proc.Stages(), " -> "))
 }
 
-func detectAnomaly(t Telemetry) AnomalyResult {
-	// Tachycardia check
-	if float64(t.Metrics.HeartRate) > hrThreshold {
-		return AnomalyResult{
-			IsAnomaly:   true,
-			AnomalyType: "tachycardia",
-			Reason:      fmt.Sprintf("Heart rate %d exceeds threshold %.0f", t.Metrics.HeartRate, hrThreshold),
+func hasStage(stages []string, name string) bool {
+	for _, stage := range stages {
+		if stage == name {
+			return true
 		}
 	}
-	
-	// Fever check
-	if t.Metrics.TempC >= tempThreshold {
-		return AnomalyResult{
-			IsAnomaly:   true,
-			AnomalyType: "fever",
-			Reason:      fmt.Sprintf("Temperature %.1f°C exceeds threshold %.1f°C", t.Metrics.TempC, tempThreshold),
-		}
+	return false
+}
+
+// handler takes Kinesis batches, and scheduled events from EventBridge,
+// which run the stale device check
+func handler(ctx context.Context, payload json.RawMessage) error {
+	var trigger struct {
+		DetailType string `json:"detail-type"`
 	}
-	
-	// Hypoxia check
-	if t.Metrics.SpO2 < 90 {
-		return AnomalyResult{
-			IsAnomaly:   true,
-			AnomalyType: "hypoxia",
-			Reason:      fmt.Sprintf("SpO2 %d%% below threshold 90%%", t.Metrics.SpO2),
-		}
+	if err := json.Unmarshal(payload, &trigger); err == nil && trigger.DetailType == "Scheduled Event" {
+		return checkStale(ctx)
 	}
-	
-	return AnomalyResult{IsAnomaly: false}
+
+	var kinesisEvent events.KinesisEvent
+	if err := json.Unmarshal(payload, &kinesisEvent); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+	return processRecords(ctx, kinesisEvent)
 }
 
-func storeTelemetry(ctx context.Context, t Telemetry, anomaly AnomalyResult) error {
-	// Create keys
-	pk := fmt.Sprintf("TENANT#%s#DEVICE#%s", t.TenantID, t.DeviceID)
-	sk := fmt.Sprintf("TS#%s", t.Timestamp)
-	
-	// TTL: 30 days from now
-	ttl := time.Now().Add(30 * 24 * time.Hour).Unix()
-	
-	// Build item
-	item := map[string]types.AttributeValue{
-		"PK":          &types.AttributeValueMemberS{Value: pk},
-		"SK":          &types.AttributeValueMemberS{Value: sk},
-		"tenant_id":   &types.AttributeValueMemberS{Value: t.TenantID},
-		"device_id":   &types.AttributeValueMemberS{Value: t.DeviceID},
-		"timestamp":   &types.AttributeValueMemberS{Value: t.Timestamp},
-		"hr_bpm":      &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", t.Metrics.HeartRate)},
-		"temp_c":      &types.AttributeValueMemberN{Value: fmt.Sprintf("%.2f", t.Metrics.TempC)},
-		"spo2_pct":    &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", t.Metrics.SpO2)},
-		"steps":       &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", t.Metrics.Steps)},
-		"battery_pct": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", t.BatteryPct)},
-		"fw_version":  &types.AttributeValueMemberS{Value: t.FWVersion},
-		"anomaly_flag": &types.AttributeValueMemberBOOL{Value: anomaly.IsAnomaly},
-		"ttl":         &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", ttl)},
-	}
-	
-	if anomaly.IsAnomaly {
-		item["anomaly_type"] = &types.AttributeValueMemberS{Value: anomaly.AnomalyType}
-	}
-	
-	// Put item
-	_, err := ddbClient.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(tableName),
-		Item:      item,
-	})
-	
-	return err
+// checkStale reports the devices, registered or seen by this instance, that
+// the latest cache shows have gone silent
+func checkStale(ctx context.Context) error {
+	if !staleChecks {
+		log.Printf("Skipping scheduled stale device check")
+		return nil
+	}
+
+	monitor := proc.StaleMonitor()
+	if err := monitor.Seed(ctx, staleTenants); err != nil {
+		return err
+	}
+	monitor.Check(ctx)
+	return nil
 }
 
-func sendAlert(ctx context.Context, t Telemetry, anomaly AnomalyResult) error {
-	message := fmt.Sprintf(`🚨 HEALTH ALERT 🚨
-
-Device: %s
-Tenant: %s
-Timestamp: %s
-
-Anomaly Type: %s
-Details: %s
-
-Vitals:
-- Heart Rate: %d bpm
-- Temperature: %.1f°C
-- SpO2: %d%%
-- Steps: %d
-- Battery: %d%%
-
-Action Required: Please check patient immediately.`,
-		t.DeviceID,
-		t.TenantID,
-		t.Timestamp,
-		anomaly.AnomalyType,
-		anomaly.Reason,
-		t.Metrics.HeartRate,
-		t.Metrics.TempC,
-		t.Metrics.SpO2,
-		t.Metrics.Steps,
-		t.BatteryPct,
-	)
-	
-	subject := fmt.Sprintf("[HealthSense] %s Alert - %s", anomaly.AnomalyType, t.DeviceID)
-	
-	_, err := snsClient.Publish(ctx, &sns.PublishInput{
-		TopicArn: aws.String(snsTopicARN),
-		Subject:  aws.String(subject),
-		Message:  aws.String(message),
-	})
-	
-	return err
+func processRecords(ctx context.Context, kinesisEvent events.KinesisEvent) error {
+	log.Printf("Processing %d records", len(kinesisEvent.Records))
+	duplicates := 0
+
+	for _, record := range kinesisEvent.Records {
+		// Records carry no topic, so only the payload itself is checked
+		msg := &pipeline.Message{Payload: record.Kinesis.Data}
+
+		err := proc.Process(ctx, msg)
+		switch {
+		case err == nil:
+		case errors.Is(err, db.ErrDuplicateReading):
+			// Already stored, and alerted on, by an earlier try of this batch
+			duplicates++
+		case pipeline.FailedAt(err, pipeline.StageDecode), pipeline.FailedAt(err, pipeline.StageValidate):
+			log.Printf("❌ Rejected record: %v", err)
+		default:
+			log.Printf("❌ Failed to process record: %v", err)
+			return err // Return error to retry
+		}
+	}
+
+	log.Printf("✅ Successfully processed %d records (%d duplicates)", len(kinesisEvent.Records), duplicates)
+	return nil
 }
 
 func main() {
 	lambda.Start(handler)
-}
\ No newline at end of file
+}
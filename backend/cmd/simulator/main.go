@@ -1,3 +1,5 @@
+//go:build !aws
+
 package main
 
 import (
@@ -14,6 +16,8 @@ import (
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/meghanan266/healthsense/backend/pkg/config"
+	"github.com/meghanan266/healthsense/backend/pkg/logging"
 )
 
 // Telemetry represents device sensor data
@@ -24,6 +28,7 @@ type Telemetry struct {
 	Metrics    Metrics   `json:"metrics"`
 	BatteryPct int       `json:"battery_pct"`
 	FWVersion  string    `json:"fw_version"`
+	Seq        int64     `json:"seq"` // Per-device sequence number, for deduplication
 }
 
 type Metrics struct {
@@ -36,15 +41,28 @@ type Metrics struct {
 var globalMetrics *MetricsTracker
 
 func main() {
+	// Settings come from the config file and environment; flags override them
+	configPath := config.PathFromArgs(os.Args[1:])
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("❌ Failed to load config: %v", err)
+	}
+
 	// Command-line flags
-	broker := flag.String("broker", "tcp://localhost:1883", "MQTT broker URL")
-	numDevices := flag.Int("devices", 5, "Number of simulated devices")
-	interval := flag.Duration("interval", 2*time.Second, "Publishing interval")
-	tenantID := flag.String("tenant", "acme-clinic", "Tenant ID")
-	duration := flag.Duration("duration", 0, "Test duration (0 = infinite)")
-	metricsFile := flag.String("metrics", "simulator-metrics.csv", "Metrics output file")
+	flag.String("config", configPath, "YAML config file (or set $"+config.PathEnv+")")
+	broker := flag.String("broker", cfg.MQTT.Broker, "MQTT broker URL")
+	numDevices := flag.Int("devices", cfg.Simulator.Devices, "Number of simulated devices")
+	interval := flag.Duration("interval", cfg.Simulator.Interval, "Publishing interval")
+	tenantID := flag.String("tenant", cfg.Simulator.Tenant, "Tenant ID")
+	duration := flag.Duration("duration", cfg.Simulator.Duration, "Test duration (0 = infinite)")
+	metricsFile := flag.String("metrics", cfg.Simulator.MetricsFile, "Metrics output file")
 	flag.Parse()
 
+	logging.SetLevel(cfg.LogLevel)
+	config.OnReload(configPath, func(cfg *config.Config) {
+		logging.SetLevel(cfg.LogLevel)
+	})
+
 	log.Printf("🚀 Starting HealthSense Simulator")
 	log.Printf("   Broker: %s", *broker)
 	log.Printf("   Devices: %d", *numDevices)
@@ -55,7 +73,6 @@ func main() {
 	}
 
 	// Initialize metrics
-	var err error
 	globalMetrics, err = NewMetrics(*metricsFile)
 	if err != nil {
 		log.Fatalf("❌ Failed to initialize metrics: %v", err)
@@ -131,6 +148,7 @@ func publishTelemetry(ctx context.Context, wg *sync.WaitGroup, client mqtt.Clien
 	baseTemp := 36.5 + rand.Float64()
 	baseSpO2 := 95 + rand.Intn(5)
 	steps := 0
+	var seq int64
 
 	for {
 		select {
@@ -144,6 +162,7 @@ func publishTelemetry(ctx context.Context, wg *sync.WaitGroup, client mqtt.Clien
 				TenantID:  tenantID,
 				DeviceID:  deviceID,
 				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				Seq:       seq + 1,
 				Metrics: Metrics{
 					HeartRate: baseHR + rand.Intn(21) - 10,
 					TempC:     baseTemp + (rand.Float64()*0.4 - 0.2),
@@ -154,6 +173,7 @@ func publishTelemetry(ctx context.Context, wg *sync.WaitGroup, client mqtt.Clien
 				FWVersion:  "1.3.2",
 			}
 			steps = telemetry.Metrics.Steps
+			seq = telemetry.Seq
 
 			// Occasionally simulate anomalies (10% chance)
 			if rand.Float32() < 0.1 {
@@ -176,6 +196,14 @@ func publishTelemetry(ctx context.Context, wg *sync.WaitGroup, client mqtt.Clien
 
 			if !success {
 				log.Printf("❌ [%s] Publish error: %v", deviceID, token.Error())
+			} else {
+				logging.Debugf("📤 [%s] HR:%d Temp:%.1f SpO2:%d (latency: %dms)",
+					deviceID,
+					telemetry.Metrics.HeartRate,
+					telemetry.Metrics.TempC,
+					telemetry.Metrics.SpO2,
+					latencyMs,
+				)
 			}
 		}
 	}
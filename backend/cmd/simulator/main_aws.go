@@ -1,3 +1,5 @@
+//go:build aws
+
 package main
 
 import (
@@ -17,6 +19,8 @@ import (
 	"io/ioutil"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/meghanan266/healthsense/backend/pkg/config"
+	"github.com/meghanan266/healthsense/backend/pkg/logging"
 )
 
 // Telemetry represents device sensor data
@@ -27,6 +31,7 @@ type TelemetryAWS struct {
 	Metrics    MetricsAWS   `json:"metrics"`
 	BatteryPct int          `json:"battery_pct"`
 	FWVersion  string       `json:"fw_version"`
+	Seq        int64        `json:"seq"` // Per-device sequence number, for deduplication
 }
 
 type MetricsAWS struct {
@@ -46,17 +51,30 @@ type MetricsTrackerAWS struct {
 var globalMetricsAWS *MetricsTrackerAWS
 
 func main() {
+	// Settings come from the config file and environment; flags override them
+	configPath := config.PathFromArgs(os.Args[1:])
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("❌ Failed to load config: %v", err)
+	}
+
 	// Command-line flags
-	awsEndpoint := flag.String("endpoint", "a3fedtp0rmwbku-ats.iot.us-east-1.amazonaws.com", "AWS IoT Core endpoint")
-	certFile := flag.String("cert", "../../../certs/certificate.pem.crt", "Device certificate file")
-	keyFile := flag.String("key", "../../../certs/private.pem.key", "Private key file")
-	caFile := flag.String("ca", "../../../certs/AmazonRootCA1.pem", "Root CA file")
-	numDevices := flag.Int("devices", 5, "Number of simulated devices")
-	interval := flag.Duration("interval", 2*time.Second, "Publishing interval")
-	tenantID := flag.String("tenant", "acme-clinic", "Tenant ID")
-	duration := flag.Duration("duration", 0, "Test duration (0 = infinite)")
+	flag.String("config", configPath, "YAML config file (or set $"+config.PathEnv+")")
+	awsEndpoint := flag.String("endpoint", cfg.AWS.IoTEndpoint, "AWS IoT Core endpoint")
+	certFile := flag.String("cert", cfg.Simulator.CertFile, "Device certificate file")
+	keyFile := flag.String("key", cfg.Simulator.KeyFile, "Private key file")
+	caFile := flag.String("ca", cfg.Simulator.CAFile, "Root CA file")
+	numDevices := flag.Int("devices", cfg.Simulator.Devices, "Number of simulated devices")
+	interval := flag.Duration("interval", cfg.Simulator.Interval, "Publishing interval")
+	tenantID := flag.String("tenant", cfg.Simulator.Tenant, "Tenant ID")
+	duration := flag.Duration("duration", cfg.Simulator.Duration, "Test duration (0 = infinite)")
 	flag.Parse()
 
+	logging.SetLevel(cfg.LogLevel)
+	config.OnReload(configPath, func(cfg *config.Config) {
+		logging.SetLevel(cfg.LogLevel)
+	})
+
 	log.Printf("🚀 Starting HealthSense AWS IoT Simulator")
 	log.Printf("   Endpoint: %s", *awsEndpoint)
 	log.Printf("   Devices: %d", *numDevices)
@@ -178,6 +196,7 @@ func publishTelemetryAWS(ctx context.Context, wg *sync.WaitGroup, client mqtt.Cl
 	baseTemp := 36.5 + rand.Float64()
 	baseSpO2 := 95 + rand.Intn(5)
 	steps := 0
+	var seq int64
 
 	for {
 		select {
@@ -191,6 +210,7 @@ func publishTelemetryAWS(ctx context.Context, wg *sync.WaitGroup, client mqtt.Cl
 				TenantID:  tenantID,
 				DeviceID:  deviceID,
 				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				Seq:       seq + 1,
 				Metrics: MetricsAWS{
 					HeartRate: baseHR + rand.Intn(21) - 10,
 					TempC:     baseTemp + (rand.Float64()*0.4 - 0.2),
@@ -201,6 +221,7 @@ func publishTelemetryAWS(ctx context.Context, wg *sync.WaitGroup, client mqtt.Cl
 				FWVersion:  "1.3.2",
 			}
 			steps = telemetry.Metrics.Steps
+			seq = telemetry.Seq
 
 			// Occasionally simulate anomalies (10% chance)
 			if rand.Float32() < 0.1 {
@@ -230,7 +251,7 @@ func publishTelemetryAWS(ctx context.Context, wg *sync.WaitGroup, client mqtt.Cl
 			if !success {
 				log.Printf("❌ [%s] Publish error: %v", deviceID, token.Error())
 			} else if rand.Float32() < 0.05 { // Log 5% of successful publishes
-				log.Printf("📤 [%s] HR:%d Temp:%.1f SpO2:%d (latency: %dms)",
+				logging.Debugf("📤 [%s] HR:%d Temp:%.1f SpO2:%d (latency: %dms)",
 					deviceID,
 					telemetry.Metrics.HeartRate,
 					telemetry.Metrics.TempC,
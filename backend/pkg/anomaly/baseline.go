@@ -0,0 +1,184 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Baseline finding types, one per vital so a reading can break several
+const (
+	TypeHeartRateDeviation = "hr_deviation"
+	TypeTempDeviation      = "temp_deviation"
+	TypeSpO2Deviation      = "spo2_deviation"
+)
+
+// Stats is an exponentially weighted moving mean and variance of one vital
+type Stats struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Count    int     `json:"count"` // Readings seen
+}
+
+// Update folds a reading into the stats, weighting it by alpha
+func (s *Stats) Update(x, alpha float64) {
+	if s.Count == 0 {
+		s.Mean, s.Variance = x, 0
+	} else {
+		diff := x - s.Mean
+		incr := alpha * diff
+		s.Mean += incr
+		s.Variance = (1 - alpha) * (s.Variance + diff*incr)
+	}
+	s.Count++
+}
+
+// Baseline is a device's rolling statistics for each vital
+type Baseline struct {
+	HeartRate Stats `json:"hr_bpm"`
+	TempC     Stats `json:"temp_c"`
+	SpO2      Stats `json:"spo2_pct"`
+
+	// Time of the latest reading folded in, so a redelivered or late reading
+	// is not counted twice
+	Last time.Time `json:"last,omitempty"`
+}
+
+// BaselineStore keeps baselines between readings and restarts
+type BaselineStore interface {
+	// GetBaseline returns a device's baseline, or nil if it has none yet
+	GetBaseline(ctx context.Context, tenantID, deviceID string) (*Baseline, error)
+	PutBaseline(ctx context.Context, tenantID, deviceID string, baseline Baseline) error
+}
+
+// BaselineSettings control how baselines are learned and judged
+type BaselineSettings struct {
+	Alpha  float64 // Weight of each new reading, between 0 and 1
+	Sigmas float64 // Standard deviations from the mean that count as a deviation
+	WarmUp int     // Readings a device needs before its baseline is used
+}
+
+// DefaultBaselineSettings returns the settings used unless configured
+// otherwise
+func DefaultBaselineSettings() BaselineSettings {
+	return BaselineSettings{Alpha: 0.05, Sigmas: 3, WarmUp: 30}
+}
+
+// Smallest standard deviation used for each vital, so a device whose
+// readings barely vary is not flagged for ordinary sensor noise
+const (
+	minHeartRateSD = 3.0
+	minTempSD      = 0.2
+	minSpO2SD      = 1.0
+)
+
+// BaselineDetector flags readings that stray from the device's own baseline.
+// It complements SimpleDetector's absolute limits, which apply whatever a
+// device's baseline is.
+type BaselineDetector struct {
+	store BaselineStore
+
+	mu       sync.RWMutex
+	settings BaselineSettings
+}
+
+// NewBaselineDetector creates a detector that keeps baselines in store
+func NewBaselineDetector(store BaselineStore, settings BaselineSettings) *BaselineDetector {
+	return &BaselineDetector{store: store, settings: settings}
+}
+
+// SetSettings replaces the settings, which is safe while readings are being
+// checked
+func (b *BaselineDetector) SetSettings(settings BaselineSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.settings = settings
+}
+
+// Check compares a reading's vitals, taken at the given time, with the
+// device's baseline, once warmed up, then folds them in. Readings that break
+// an absolute limit are not folded in, so a baseline does not drift towards a
+// dangerous state, and neither are readings no newer than the last one folded
+// in, such as redeliveries.
+func (b *BaselineDetector) Check(ctx context.Context, r Reading, at time.Time, absolute AnomalyResult) ([]Finding, error) {
+	b.mu.RLock()
+	settings := b.settings
+	b.mu.RUnlock()
+
+	baseline, err := b.store.GetBaseline(ctx, r.TenantID, r.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load baseline: %w", err)
+	}
+	if baseline == nil {
+		baseline = &Baseline{}
+	}
+
+	var findings []Finding
+	deviation := func(typ, metric string, stats Stats, value, minSD float64, format string) {
+		if stats.Count < settings.WarmUp {
+			return
+		}
+		sd := math.Max(math.Sqrt(stats.Variance), minSD)
+		if math.Abs(value-stats.Mean) <= settings.Sigmas*sd {
+			return
+		}
+		direction := "above"
+		threshold := stats.Mean + settings.Sigmas*sd
+		if value < stats.Mean {
+			direction = "below"
+			threshold = stats.Mean - settings.Sigmas*sd
+		}
+		findings = append(findings, Finding{
+			Type:      typ,
+			Severity:  SeverityInfo,
+			Metric:    metric,
+			Value:     value,
+			Threshold: math.Round(threshold*10) / 10,
+			Reason: fmt.Sprintf("%s "+format+" is %.1f SD %s the device's baseline "+format,
+				metricLabel(metric), value, math.Abs(value-stats.Mean)/sd, direction, stats.Mean),
+		})
+	}
+	deviation(TypeHeartRateDeviation, "hr_bpm", baseline.HeartRate, float64(r.HeartRate), minHeartRateSD, "%.0f")
+	deviation(TypeTempDeviation, "temp_c", baseline.TempC, r.TempC, minTempSD, "%.1f°C")
+	deviation(TypeSpO2Deviation, "spo2_pct", baseline.SpO2, float64(r.SpO2), minSpO2SD, "%.0f%%")
+
+	if breaksVitalLimit(absolute) || (!at.IsZero() && !at.After(baseline.Last)) {
+		return findings, nil
+	}
+
+	baseline.HeartRate.Update(float64(r.HeartRate), settings.Alpha)
+	baseline.TempC.Update(r.TempC, settings.Alpha)
+	baseline.SpO2.Update(float64(r.SpO2), settings.Alpha)
+	if at.After(baseline.Last) {
+		baseline.Last = at
+	}
+	if err := b.store.PutBaseline(ctx, r.TenantID, r.DeviceID, *baseline); err != nil {
+		return findings, fmt.Errorf("failed to save baseline: %w", err)
+	}
+	return findings, nil
+}
+
+func breaksVitalLimit(result AnomalyResult) bool {
+	for _, f := range result.Findings {
+		switch f.Metric {
+		case "hr_bpm", "temp_c", "spo2_pct":
+			return true
+		}
+	}
+	return false
+}
+
+func metricLabel(metric string) string {
+	switch metric {
+	case "hr_bpm":
+		return "Heart rate"
+	case "temp_c":
+		return "Temperature"
+	case "spo2_pct":
+		return "SpO2"
+	}
+	return metric
+}
@@ -1,59 +1,299 @@
 package anomaly
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severity ranks how urgently a finding needs attention
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Rank orders severities, higher being more urgent
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityCritical:
+		return 3
+	case SeverityWarning:
+		return 2
+	case SeverityInfo:
+		return 1
+	}
+	return 0
+}
+
+// Finding is a single rule that a reading broke
+type Finding struct {
+	Type      string   `json:"type"`
+	Severity  Severity `json:"severity"`
+	Metric    string   `json:"metric"` // Reading field, e.g. spo2_pct
+	Value     float64  `json:"value"`
+	Threshold float64  `json:"threshold"`
+	Reason    string   `json:"reason"`
+}
 
 // AnomalyResult represents detection result
 type AnomalyResult struct {
 	IsAnomaly   bool
-	AnomalyType string
-	Reason      string
+	AnomalyType string   // Every finding's type, most severe first, comma-separated
+	Reason      string   // Every finding's reason, in the same order
+	Severity    Severity // Of the most severe finding
+	Findings    []Finding
+}
+
+// NewResult summarises findings into a result, ordering them most severe
+// first
+func NewResult(findings []Finding) AnomalyResult {
+	if len(findings) == 0 {
+		return AnomalyResult{IsAnomaly: false}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity.Rank() > findings[j].Severity.Rank()
+	})
+
+	types := make([]string, len(findings))
+	reasons := make([]string, len(findings))
+	for i, f := range findings {
+		types[i] = f.Type
+		reasons[i] = f.Reason
+	}
+
+	return AnomalyResult{
+		IsAnomaly:   true,
+		AnomalyType: strings.Join(types, ","),
+		Reason:      strings.Join(reasons, "; "),
+		Severity:    findings[0].Severity,
+		Findings:    findings,
+	}
+}
+
+// Reading is what the rules check. Callers skip the vitals or battery rules
+// when that sensor reported an implausible value.
+type Reading struct {
+	TenantID    string
+	DeviceID    string
+	HeartRate   int
+	TempC       float64
+	SpO2        int
+	BatteryPct  int
+	SkipVitals  bool
+	SkipBattery bool
+}
+
+// Types lists the findings' types, most severe first
+func (r AnomalyResult) Types() []string {
+	types := make([]string, len(r.Findings))
+	for i, f := range r.Findings {
+		types[i] = f.Type
+	}
+	return types
 }
 
 // SimpleDetector implements basic rule-based anomaly detection
 type SimpleDetector struct {
-	// Thresholds
-	TachycardiaThreshold float64 // BPM
-	FeverThreshold       float64 // Celsius
-	LowSpO2Threshold     int     // Percentage
+	mu sync.RWMutex // guards the thresholds and rules, which may change while in use
+
+	Thresholds
+
+	rules   map[string]bool            // Enabled for tenants without their own list
+	tenants map[string]map[string]bool // tenant_id -> enabled rules
 }
 
-// NewSimpleDetector creates a detector with default thresholds
+// NewSimpleDetector creates a detector with default thresholds and every
+// rule enabled
 func NewSimpleDetector() *SimpleDetector {
 	return &SimpleDetector{
-		TachycardiaThreshold: 150.0,
-		FeverThreshold:       38.0,
-		LowSpO2Threshold:     90,
+		Thresholds: DefaultThresholds(),
+		rules:      ruleSet(AllRules),
+		tenants:    make(map[string]map[string]bool),
 	}
 }
 
-// Detect checks telemetry for anomalies
-func (d *SimpleDetector) Detect(hr int, tempC float64, spo2 int) AnomalyResult {
-	// Check tachycardia (high heart rate)
-	if float64(hr) > d.TachycardiaThreshold {
-		return AnomalyResult{
-			IsAnomaly:   true,
-			AnomalyType: "tachycardia",
-			Reason:      fmt.Sprintf("Heart rate %d exceeds threshold %.0f", hr, d.TachycardiaThreshold),
+// SetThresholds replaces the thresholds, which is safe while readings are
+// being checked
+func (d *SimpleDetector) SetThresholds(t Thresholds) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.Thresholds = t
+}
+
+// SetRules chooses the enabled rules: defaults for every tenant, except
+// those given their own list in tenants
+func (d *SimpleDetector) SetRules(defaults []string, tenants map[string][]string) error {
+	if err := CheckRules(defaults); err != nil {
+		return err
+	}
+	perTenant := make(map[string]map[string]bool, len(tenants))
+	for tenantID, names := range tenants {
+		if err := CheckRules(names); err != nil {
+			return fmt.Errorf("tenant %s: %w", tenantID, err)
 		}
+		perTenant[tenantID] = ruleSet(names)
 	}
 
-	// Check fever
-	if tempC >= d.FeverThreshold {
-		return AnomalyResult{
-			IsAnomaly:   true,
-			AnomalyType: "fever",
-			Reason:      fmt.Sprintf("Temperature %.1f°C exceeds threshold %.1f°C", tempC, d.FeverThreshold),
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rules = ruleSet(defaults)
+	d.tenants = perTenant
+	return nil
+}
+
+// Enabled reports whether a rule applies to a tenant
+func (d *SimpleDetector) Enabled(tenantID, rule string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.enabled(tenantID, rule)
+}
+
+// enabled reports whether a rule applies to a tenant. Callers hold d.mu.
+func (d *SimpleDetector) enabled(tenantID, rule string) bool {
+	if rules, ok := d.tenants[tenantID]; ok {
+		return rules[rule]
+	}
+	return d.rules[rule]
+}
+
+// Detect checks a reading against every enabled rule and reports all that
+// match
+func (d *SimpleDetector) Detect(r Reading) AnomalyResult {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var findings []Finding
+	check := func(rule string, f Finding) {
+		if d.enabled(r.TenantID, rule) {
+			f.Type = rule
+			findings = append(findings, f)
 		}
 	}
 
-	// Check low oxygen
-	if spo2 < d.LowSpO2Threshold {
-		return AnomalyResult{
-			IsAnomaly:   true,
-			AnomalyType: "hypoxia",
-			Reason:      fmt.Sprintf("SpO2 %d%% below threshold %d%%", spo2, d.LowSpO2Threshold),
+	if !r.SkipVitals {
+		// Heart rate
+		if float64(r.HeartRate) > d.TachycardiaThreshold {
+			check(RuleTachycardia, Finding{
+				Severity:  SeverityWarning,
+				Metric:    "hr_bpm",
+				Value:     float64(r.HeartRate),
+				Threshold: d.TachycardiaThreshold,
+				Reason:    fmt.Sprintf("Heart rate %d exceeds threshold %.0f", r.HeartRate, d.TachycardiaThreshold),
+			})
+		} else if float64(r.HeartRate) < d.BradycardiaThreshold {
+			check(RuleBradycardia, Finding{
+				Severity:  SeverityWarning,
+				Metric:    "hr_bpm",
+				Value:     float64(r.HeartRate),
+				Threshold: d.BradycardiaThreshold,
+				Reason:    fmt.Sprintf("Heart rate %d below threshold %.0f", r.HeartRate, d.BradycardiaThreshold),
+			})
 		}
+
+		// Temperature
+		if r.TempC >= d.FeverThreshold {
+			check(RuleFever, Finding{
+				Severity:  SeverityWarning,
+				Metric:    "temp_c",
+				Value:     r.TempC,
+				Threshold: d.FeverThreshold,
+				Reason:    fmt.Sprintf("Temperature %.1f°C exceeds threshold %.1f°C", r.TempC, d.FeverThreshold),
+			})
+		} else if r.TempC < d.HypothermiaThreshold {
+			check(RuleHypothermia, Finding{
+				Severity:  SeverityWarning,
+				Metric:    "temp_c",
+				Value:     r.TempC,
+				Threshold: d.HypothermiaThreshold,
+				Reason:    fmt.Sprintf("Temperature %.1f°C below threshold %.1f°C", r.TempC, d.HypothermiaThreshold),
+			})
+		}
+
+		// Oxygen, graded: the critical band wins over the warning band
+		if r.SpO2 < d.LowSpO2Threshold {
+			check(RuleHypoxia, Finding{
+				Severity:  SeverityCritical,
+				Metric:    "spo2_pct",
+				Value:     float64(r.SpO2),
+				Threshold: float64(d.LowSpO2Threshold),
+				Reason:    fmt.Sprintf("SpO2 %d%% below threshold %d%%", r.SpO2, d.LowSpO2Threshold),
+			})
+		} else if r.SpO2 < d.SpO2WarningThreshold {
+			check(RuleHypoxia, Finding{
+				Severity:  SeverityWarning,
+				Metric:    "spo2_pct",
+				Value:     float64(r.SpO2),
+				Threshold: float64(d.SpO2WarningThreshold),
+				Reason:    fmt.Sprintf("SpO2 %d%% below threshold %d%%", r.SpO2, d.SpO2WarningThreshold),
+			})
+		}
+	}
+
+	// Device health
+	if !r.SkipBattery && r.BatteryPct < d.LowBatteryThreshold {
+		check(RuleLowBattery, Finding{
+			Severity:  SeverityInfo,
+			Metric:    "battery_pct",
+			Value:     float64(r.BatteryPct),
+			Threshold: float64(d.LowBatteryThreshold),
+			Reason:    fmt.Sprintf("Battery %d%% below threshold %d%%", r.BatteryPct, d.LowBatteryThreshold),
+		})
+	}
+
+	return NewResult(findings)
+}
+
+// Recovered reports whether a reading is back past a condition's recovery
+// threshold. Conditions without one recover as soon as they are not found.
+func (d *SimpleDetector) Recovered(rule string, r Reading) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	switch rule {
+	case RuleTachycardia:
+		return float64(r.HeartRate) <= d.TachycardiaRecovery
+	case RuleBradycardia:
+		return float64(r.HeartRate) >= d.BradycardiaRecovery
+	case RuleFever:
+		return r.TempC < d.FeverRecovery
+	case RuleHypothermia:
+		return r.TempC >= d.HypothermiaRecovery
+	case RuleHypoxia:
+		return r.SpO2 >= d.SpO2Recovery
+	case RuleLowBattery:
+		return r.BatteryPct >= d.LowBatteryRecovery
+	}
+	return true
+}
+
+// CheckStale reports a device that has gone silent for longer than the
+// stale threshold, if the rule is enabled for its tenant
+func (d *SimpleDetector) CheckStale(tenantID string, silence time.Duration) AnomalyResult {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	limit := d.StaleAfter()
+	if !d.enabled(tenantID, RuleStaleDevice) || limit <= 0 || silence <= limit {
+		return AnomalyResult{IsAnomaly: false}
 	}
+	silence = silence.Truncate(time.Second)
 
-	return AnomalyResult{IsAnomaly: false}
+	return NewResult([]Finding{{
+		Type:      RuleStaleDevice,
+		Severity:  SeverityWarning,
+		Metric:    "silence_s",
+		Value:     silence.Seconds(),
+		Threshold: limit.Seconds(),
+		Reason: fmt.Sprintf("No reading for %v, over %d intervals of %v",
+			silence, d.StaleIntervals, d.ReadingInterval),
+	}})
 }
\ No newline at end of file
@@ -0,0 +1,140 @@
+package anomaly
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rule names, used as finding types and in tenant rule lists
+const (
+	RuleTachycardia  = "tachycardia"
+	RuleBradycardia  = "bradycardia"
+	RuleFever        = "fever"
+	RuleHypothermia  = "hypothermia"
+	RuleHypoxia      = "hypoxia"
+	RuleLowBattery   = "low_battery"
+	RuleStaleDevice  = "stale_device"
+	RuleBaseline     = "baseline"      // Deviations from the device's own baseline
+	RuleEarlyWarning = "early_warning" // Early warning score in or above the alert band
+)
+
+// AllRules lists every rule the detector knows
+var AllRules = []string{
+	RuleTachycardia, RuleBradycardia, RuleFever, RuleHypothermia,
+	RuleHypoxia, RuleLowBattery, RuleStaleDevice, RuleBaseline, RuleEarlyWarning,
+}
+
+// Thresholds are the limits the rules check readings against
+type Thresholds struct {
+	TachycardiaThreshold float64 // BPM; warning above it
+	BradycardiaThreshold float64 // BPM; warning below it
+	FeverThreshold       float64 // Celsius; warning at or above it
+	HypothermiaThreshold float64 // Celsius; warning below it
+	SpO2WarningThreshold int     // Percentage; warning below it
+	LowSpO2Threshold     int     // Percentage; critical below it
+	LowBatteryThreshold  int     // Percentage; info below it
+
+	// Early warning scores in this band or above are reported, with a
+	// severity that rises with the band
+	ScoreAlertBand RiskBand
+
+	// Findings below this severity are recorded but do not alert staff
+	NotifySeverity Severity
+
+	// An open condition clears once the reading is back past its recovery
+	// threshold, on the safe side of the one that opened it
+	TachycardiaRecovery float64 // BPM; clears at or below it
+	BradycardiaRecovery float64 // BPM; clears at or above it
+	FeverRecovery       float64 // Celsius; clears below it
+	HypothermiaRecovery float64 // Celsius; clears at or above it
+	SpO2Recovery        int     // Percentage; clears at or above it
+	LowBatteryRecovery  int     // Percentage; clears at or above it
+
+	// A device is stale, a warning, after StaleIntervals reading intervals
+	// without a reading
+	ReadingInterval time.Duration
+	StaleIntervals  int
+}
+
+// DefaultThresholds returns the thresholds used unless configured otherwise
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		TachycardiaThreshold: 150.0,
+		BradycardiaThreshold: 40.0,
+		FeverThreshold:       38.0,
+		HypothermiaThreshold: 35.0,
+		SpO2WarningThreshold: 94,
+		LowSpO2Threshold:     90,
+		LowBatteryThreshold:  15,
+		ScoreAlertBand:       RiskMedium,
+		NotifySeverity:       SeverityWarning,
+		TachycardiaRecovery:  140.0,
+		BradycardiaRecovery:  45.0,
+		FeverRecovery:        37.8,
+		HypothermiaRecovery:  35.5,
+		SpO2Recovery:         95,
+		LowBatteryRecovery:   20,
+		ReadingInterval:      2 * time.Second,
+		StaleIntervals:       5,
+	}
+}
+
+// StaleAfter is how long a device may go without a reading
+func (t Thresholds) StaleAfter() time.Duration {
+	return t.ReadingInterval * time.Duration(t.StaleIntervals)
+}
+
+// ParseSeverity checks a severity name
+func ParseSeverity(name string) (Severity, error) {
+	severity := Severity(name)
+	if severity.Rank() == 0 {
+		return "", fmt.Errorf("unknown severity %q (expected info, warning or critical)", name)
+	}
+	return severity, nil
+}
+
+// Notifiable returns the findings of a result severe enough to alert staff
+// about
+func (d *SimpleDetector) Notifiable(result AnomalyResult) AnomalyResult {
+	d.mu.RLock()
+	minimum := d.NotifySeverity.Rank()
+	d.mu.RUnlock()
+
+	var findings []Finding
+	for _, f := range result.Findings {
+		if f.Severity.Rank() >= minimum {
+			findings = append(findings, f)
+		}
+	}
+	if len(findings) == len(result.Findings) {
+		return result
+	}
+	return NewResult(findings)
+}
+
+// CheckRules returns an error naming the first unknown rule in names
+func CheckRules(names []string) error {
+	for _, name := range names {
+		if !knownRule(name) {
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return nil
+}
+
+func knownRule(name string) bool {
+	for _, rule := range AllRules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
@@ -0,0 +1,202 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// RiskBand is the clinical risk an early warning score points to
+type RiskBand string
+
+const (
+	RiskLow       RiskBand = "low"
+	RiskLowMedium RiskBand = "low_medium" // A single vital scored 3
+	RiskMedium    RiskBand = "medium"
+	RiskHigh      RiskBand = "high"
+)
+
+// Rank orders risk bands, higher being more urgent
+func (b RiskBand) Rank() int {
+	switch b {
+	case RiskHigh:
+		return 4
+	case RiskMedium:
+		return 3
+	case RiskLowMedium:
+		return 2
+	case RiskLow:
+		return 1
+	}
+	return 0
+}
+
+// ParseRiskBand checks a risk band name
+func ParseRiskBand(name string) (RiskBand, error) {
+	band := RiskBand(name)
+	if band.Rank() == 0 {
+		return "", fmt.Errorf("unknown risk band %q (expected low, low_medium, medium or high)", name)
+	}
+	return band, nil
+}
+
+// minTotal is the lowest total score in the band, or 0 for the bands a
+// total does not set
+func (b RiskBand) minTotal() int {
+	switch b {
+	case RiskHigh:
+		return 7
+	case RiskMedium:
+		return 5
+	}
+	return 0
+}
+
+// severity is the severity of a finding in the band
+func (b RiskBand) severity() Severity {
+	switch b {
+	case RiskHigh:
+		return SeverityCritical
+	case RiskMedium:
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
+
+// ScoreBand awards Score to values up to and including Max
+type ScoreBand struct {
+	Max   float64
+	Score int
+}
+
+// Parameter is one vital an early warning score is built from. Its bands
+// are in increasing order of Max, the last one unbounded.
+type Parameter struct {
+	Metric string // Reading field, e.g. hr_bpm
+	Bands  []ScoreBand
+}
+
+// score returns the sub-score for a value
+func (p Parameter) score(value float64) int {
+	for _, band := range p.Bands {
+		if value <= band.Max {
+			return band.Score
+		}
+	}
+	return 0
+}
+
+// NEWS2Parameters are the NEWS2 scoring tables. Devices do not yet report
+// respiratory rate or blood pressure; those parameters score once readings
+// carry them.
+var NEWS2Parameters = []Parameter{
+	{Metric: "hr_bpm", Bands: []ScoreBand{
+		{40, 3}, {50, 1}, {90, 0}, {110, 1}, {130, 2}, {math.Inf(1), 3},
+	}},
+	{Metric: "temp_c", Bands: []ScoreBand{
+		{35.0, 3}, {36.0, 1}, {38.0, 0}, {39.0, 1}, {math.Inf(1), 2},
+	}},
+	{Metric: "spo2_pct", Bands: []ScoreBand{
+		{91, 3}, {93, 2}, {95, 1}, {math.Inf(1), 0},
+	}},
+	{Metric: "resp_rate", Bands: []ScoreBand{
+		{8, 3}, {11, 1}, {20, 0}, {24, 2}, {math.Inf(1), 3},
+	}},
+	{Metric: "systolic_bp", Bands: []ScoreBand{
+		{90, 3}, {100, 2}, {110, 1}, {219, 0}, {math.Inf(1), 3},
+	}},
+}
+
+// EarlyWarningScore is a reading's aggregate score and the risk it points to
+type EarlyWarningScore struct {
+	Total     int            `json:"total"`
+	SubScores map[string]int `json:"sub_scores"` // By metric, for the vitals scored
+	Band      RiskBand       `json:"band"`
+}
+
+// Scorer computes early warning scores from a set of parameters
+type Scorer struct {
+	parameters []Parameter
+}
+
+// NewScorer creates a scorer for the given parameters
+func NewScorer(parameters []Parameter) *Scorer {
+	return &Scorer{parameters: parameters}
+}
+
+// NewNEWS2Scorer creates a scorer with the NEWS2 tables
+func NewNEWS2Scorer() *Scorer {
+	return NewScorer(NEWS2Parameters)
+}
+
+// Score scores the vitals in values, keyed by metric. Parameters without a
+// value are left out of the total.
+func (s *Scorer) Score(values map[string]float64) EarlyWarningScore {
+	score := EarlyWarningScore{SubScores: make(map[string]int), Band: RiskLow}
+
+	maxSub := 0
+	for _, p := range s.parameters {
+		value, ok := values[p.Metric]
+		if !ok {
+			continue
+		}
+		sub := p.score(value)
+		score.SubScores[p.Metric] = sub
+		score.Total += sub
+		if sub > maxSub {
+			maxSub = sub
+		}
+	}
+
+	switch {
+	case score.Total >= RiskHigh.minTotal():
+		score.Band = RiskHigh
+	case score.Total >= RiskMedium.minTotal():
+		score.Band = RiskMedium
+	case maxSub >= 3:
+		score.Band = RiskLowMedium
+	}
+	return score
+}
+
+// CheckScore reports a score whose band is at or above the alert band, if
+// the early warning rule is enabled for the tenant. The threshold is the
+// lowest total in the score's band; a low-medium score is set by a single
+// vital instead, named in the reason, so it has none.
+func (d *SimpleDetector) CheckScore(tenantID string, score EarlyWarningScore) []Finding {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.enabled(tenantID, RuleEarlyWarning) || score.Band.Rank() < d.ScoreAlertBand.Rank() {
+		return nil
+	}
+
+	metrics := make([]string, 0, len(score.SubScores))
+	for metric := range score.SubScores {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	parts := make([]string, len(metrics))
+	risk := strings.ReplaceAll(string(score.Band), "_", "-") + " risk"
+	for i, metric := range metrics {
+		parts[i] = fmt.Sprintf("%s %d", metric, score.SubScores[metric])
+	}
+	if score.Band == RiskLowMedium {
+		for _, metric := range metrics {
+			if score.SubScores[metric] >= 3 {
+				risk += ", " + metric + " scored 3"
+				break
+			}
+		}
+	}
+
+	return []Finding{{
+		Type:      RuleEarlyWarning,
+		Severity:  score.Band.severity(),
+		Metric:    "ews_score",
+		Value:     float64(score.Total),
+		Threshold: float64(score.Band.minTotal()),
+		Reason:    fmt.Sprintf("Early warning score %d (%s): %s", score.Total, risk, strings.Join(parts, ", ")),
+	}}
+}
@@ -0,0 +1,188 @@
+package anomaly
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNEWS2SubScores(t *testing.T) {
+	tests := []struct {
+		metric string
+		value  float64
+		want   int
+	}{
+		{"hr_bpm", 30, 3},
+		{"hr_bpm", 40, 3},
+		{"hr_bpm", 41, 1},
+		{"hr_bpm", 50, 1},
+		{"hr_bpm", 51, 0},
+		{"hr_bpm", 90, 0},
+		{"hr_bpm", 91, 1},
+		{"hr_bpm", 110, 1},
+		{"hr_bpm", 111, 2},
+		{"hr_bpm", 130, 2},
+		{"hr_bpm", 131, 3},
+		{"hr_bpm", 200, 3},
+
+		{"temp_c", 35.0, 3},
+		{"temp_c", 35.1, 1},
+		{"temp_c", 36.0, 1},
+		{"temp_c", 36.1, 0},
+		{"temp_c", 38.0, 0},
+		{"temp_c", 38.1, 1},
+		{"temp_c", 39.0, 1},
+		{"temp_c", 39.1, 2},
+
+		{"spo2_pct", 85, 3},
+		{"spo2_pct", 91, 3},
+		{"spo2_pct", 92, 2},
+		{"spo2_pct", 93, 2},
+		{"spo2_pct", 94, 1},
+		{"spo2_pct", 95, 1},
+		{"spo2_pct", 96, 0},
+		{"spo2_pct", 100, 0},
+
+		{"resp_rate", 8, 3},
+		{"resp_rate", 9, 1},
+		{"resp_rate", 12, 0},
+		{"resp_rate", 21, 2},
+		{"resp_rate", 25, 3},
+
+		{"systolic_bp", 90, 3},
+		{"systolic_bp", 91, 2},
+		{"systolic_bp", 101, 1},
+		{"systolic_bp", 111, 0},
+		{"systolic_bp", 219, 0},
+		{"systolic_bp", 220, 3},
+	}
+
+	scorer := NewNEWS2Scorer()
+	for _, tt := range tests {
+		score := scorer.Score(map[string]float64{tt.metric: tt.value})
+		if got := score.SubScores[tt.metric]; got != tt.want {
+			t.Errorf("%s %v scored %d, want %d", tt.metric, tt.value, got, tt.want)
+		}
+		if score.Total != tt.want {
+			t.Errorf("%s %v total %d, want %d", tt.metric, tt.value, score.Total, tt.want)
+		}
+	}
+}
+
+func TestNEWS2Bands(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]float64
+		total  int
+		band   RiskBand
+	}{
+		{"normal", map[string]float64{"hr_bpm": 70, "temp_c": 36.8, "spo2_pct": 98}, 0, RiskLow},
+		{"mild", map[string]float64{"hr_bpm": 95, "temp_c": 38.5, "spo2_pct": 94}, 3, RiskLow},
+		{"single vital scored 3", map[string]float64{"hr_bpm": 70, "temp_c": 36.8, "spo2_pct": 91}, 3, RiskLowMedium},
+		{"single 3 and more", map[string]float64{"hr_bpm": 95, "temp_c": 36.8, "spo2_pct": 91}, 4, RiskLowMedium},
+		{"medium from the total", map[string]float64{"hr_bpm": 115, "temp_c": 38.5, "spo2_pct": 93}, 5, RiskMedium},
+		{"medium with a single 3", map[string]float64{"hr_bpm": 115, "temp_c": 36.8, "spo2_pct": 91}, 5, RiskMedium},
+		{"high", map[string]float64{"hr_bpm": 135, "temp_c": 39.5, "spo2_pct": 93}, 7, RiskHigh},
+		{"missing vitals left out", map[string]float64{"spo2_pct": 92}, 2, RiskLow},
+	}
+
+	scorer := NewNEWS2Scorer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := scorer.Score(tt.values)
+			if score.Total != tt.total || score.Band != tt.band {
+				t.Errorf("Score = %d (%s), want %d (%s)", score.Total, score.Band, tt.total, tt.band)
+			}
+			if len(score.SubScores) != len(tt.values) {
+				t.Errorf("sub-scores %v, want one per value", score.SubScores)
+			}
+		})
+	}
+}
+
+func TestCheckScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		alertBand RiskBand
+		values    map[string]float64
+		severity  Severity // Empty for no finding
+		threshold float64
+		reason    string // Part of the reason
+	}{
+		{
+			name:      "below the alert band",
+			alertBand: RiskMedium,
+			values:    map[string]float64{"hr_bpm": 70, "temp_c": 36.8, "spo2_pct": 91},
+		},
+		{
+			name:      "medium",
+			alertBand: RiskMedium,
+			values:    map[string]float64{"hr_bpm": 115, "temp_c": 38.5, "spo2_pct": 93},
+			severity:  SeverityWarning,
+			threshold: 5,
+			reason:    "Early warning score 5 (medium risk): hr_bpm 2, spo2_pct 2, temp_c 1",
+		},
+		{
+			name:      "high reports its own band",
+			alertBand: RiskMedium,
+			values:    map[string]float64{"hr_bpm": 135, "temp_c": 39.5, "spo2_pct": 93},
+			severity:  SeverityCritical,
+			threshold: 7,
+		},
+		{
+			name:      "low-medium names the vital",
+			alertBand: RiskLowMedium,
+			values:    map[string]float64{"hr_bpm": 70, "temp_c": 36.8, "spo2_pct": 91},
+			severity:  SeverityInfo,
+			threshold: 0,
+			reason:    "(low-medium risk, spo2_pct scored 3)",
+		},
+		{
+			name:      "medium under a low-medium alert band",
+			alertBand: RiskLowMedium,
+			values:    map[string]float64{"hr_bpm": 115, "temp_c": 36.8, "spo2_pct": 91},
+			severity:  SeverityWarning,
+			threshold: 5,
+			reason:    "(medium risk)",
+		},
+	}
+
+	scorer := NewNEWS2Scorer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := NewSimpleDetector()
+			thresholds := DefaultThresholds()
+			thresholds.ScoreAlertBand = tt.alertBand
+			detector.SetThresholds(thresholds)
+
+			findings := detector.CheckScore("acme-clinic", scorer.Score(tt.values))
+			if tt.severity == "" {
+				if len(findings) != 0 {
+					t.Fatalf("findings %+v, want none", findings)
+				}
+				return
+			}
+			if len(findings) != 1 {
+				t.Fatalf("findings %+v, want one", findings)
+			}
+			f := findings[0]
+			if f.Type != RuleEarlyWarning || f.Severity != tt.severity || f.Threshold != tt.threshold {
+				t.Errorf("finding %s (%s) threshold %v, want %s (%s) threshold %v",
+					f.Type, f.Severity, f.Threshold, RuleEarlyWarning, tt.severity, tt.threshold)
+			}
+			if !strings.Contains(f.Reason, tt.reason) {
+				t.Errorf("reason %q, want it to contain %q", f.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCheckScoreRuleDisabled(t *testing.T) {
+	detector := NewSimpleDetector()
+	if err := detector.SetRules([]string{RuleTachycardia}, nil); err != nil {
+		t.Fatal(err)
+	}
+	score := NewNEWS2Scorer().Score(map[string]float64{"hr_bpm": 135, "temp_c": 39.5, "spo2_pct": 93})
+	if findings := detector.CheckScore("acme-clinic", score); len(findings) != 0 {
+		t.Errorf("findings %+v with early_warning disabled, want none", findings)
+	}
+}
@@ -0,0 +1,189 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Episode is the state of one condition on one device
+type Episode struct {
+	Count    int       `json:"count"` // Consecutive readings with the condition
+	Since    time.Time `json:"since"` // Time of the first of them
+	Open     bool      `json:"open"`
+	Severity Severity  `json:"severity,omitempty"` // Most severe reported while open
+	Last     time.Time `json:"last,omitempty"`     // Time of the latest reading applied
+}
+
+// newer reports whether a reading taken at the given time comes after the
+// latest one applied to an episode, so a redelivery is not counted twice
+func (ep Episode) newer(at time.Time) bool {
+	return at.IsZero() || at.After(ep.Last)
+}
+
+// EpisodeStore keeps each device's episodes, by condition, between readings
+type EpisodeStore interface {
+	// GetEpisodes returns a device's episodes, or nil if it has none
+	GetEpisodes(ctx context.Context, tenantID, deviceID string) (map[string]Episode, error)
+	PutEpisodes(ctx context.Context, tenantID, deviceID string, episodes map[string]Episode) error
+}
+
+// SustainSettings control how long a condition must last before it opens
+type SustainSettings struct {
+	Readings int           // Consecutive readings with the condition
+	Window   time.Duration // Or for this long; 0 disables the window
+}
+
+// DefaultSustainSettings returns the settings used unless configured
+// otherwise
+func DefaultSustainSettings() SustainSettings {
+	return SustainSettings{Readings: 3}
+}
+
+// SustainedDetector debounces findings. A condition opens, and is reported,
+// once it has lasted the configured number of readings or time window;
+// critical findings open at once. An open condition is reported again only
+// if it grows more severe, and clears once the vitals are back past the
+// detector's recovery thresholds.
+type SustainedDetector struct {
+	store    EpisodeStore
+	detector *SimpleDetector
+
+	mu       sync.RWMutex
+	settings SustainSettings
+}
+
+// NewSustainedDetector creates a detector that keeps episodes in store and
+// takes recovery thresholds from detector
+func NewSustainedDetector(store EpisodeStore, detector *SimpleDetector, settings SustainSettings) *SustainedDetector {
+	return &SustainedDetector{store: store, detector: detector, settings: settings}
+}
+
+// SetSettings replaces the settings, which is safe while readings are being
+// checked
+func (s *SustainedDetector) SetSettings(settings SustainSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings = settings
+}
+
+// Apply folds a reading's findings, taken at the given time, into the
+// device's episodes. It returns the findings to report now, and the
+// conditions open after the reading, most severe first. A reading no newer
+// than the last one applied to an episode, such as a redelivery, neither
+// extends nor clears it.
+func (s *SustainedDetector) Apply(ctx context.Context, r Reading, at time.Time, found AnomalyResult) (AnomalyResult, []string, error) {
+	s.mu.RLock()
+	settings := s.settings
+	s.mu.RUnlock()
+
+	episodes, err := s.store.GetEpisodes(ctx, r.TenantID, r.DeviceID)
+	if err != nil {
+		return found, found.Types(), fmt.Errorf("failed to load episodes: %w", err)
+	}
+	if episodes == nil {
+		episodes = make(map[string]Episode)
+	}
+	changed := false
+
+	var report []Finding
+	present := make(map[string]bool, len(found.Findings))
+	for _, f := range found.Findings {
+		present[f.Type] = true
+
+		ep := episodes[f.Type]
+		if !ep.newer(at) {
+			continue
+		}
+		if ep.Count == 0 {
+			ep.Since = at
+		}
+		ep.Count++
+		if at.After(ep.Last) {
+			ep.Last = at
+		}
+
+		sustained := ep.Count >= settings.Readings || (settings.Window > 0 && at.Sub(ep.Since) >= settings.Window)
+		if !ep.Open && (sustained || f.Severity == SeverityCritical) {
+			ep.Open, ep.Severity = true, f.Severity
+			report = append(report, f)
+		} else if ep.Open && f.Severity.Rank() > ep.Severity.Rank() {
+			ep.Severity = f.Severity
+			report = append(report, f)
+		}
+
+		episodes[f.Type] = ep
+		changed = true
+	}
+
+	for typ, ep := range episodes {
+		if present[typ] {
+			continue
+		}
+		// A sensor fault says nothing about the condition, but any reading
+		// ends a silence
+		if (typ == RuleLowBattery && r.SkipBattery) || (typ != RuleLowBattery && typ != RuleStaleDevice && r.SkipVitals) {
+			continue
+		}
+		if !ep.newer(at) || (ep.Open && !s.detector.Recovered(typ, r)) {
+			continue
+		}
+		if ep.Open {
+			log.Printf("[%s] Cleared: %s", r.DeviceID, typ)
+		}
+		delete(episodes, typ)
+		changed = true
+	}
+
+	if changed {
+		if err := s.store.PutEpisodes(ctx, r.TenantID, r.DeviceID, episodes); err != nil {
+			return NewResult(report), openTypes(episodes), fmt.Errorf("failed to save episodes: %w", err)
+		}
+	}
+	return NewResult(report), openTypes(episodes), nil
+}
+
+// Open opens a condition found outside a reading, such as a device gone
+// silent, at once. It reports whether the condition was newly opened; one
+// already open, e.g. reported before a restart or by another consumer, is
+// left as it is. The device's next reading clears it like any other.
+func (s *SustainedDetector) Open(ctx context.Context, tenantID, deviceID string, f Finding, at time.Time) (bool, error) {
+	episodes, err := s.store.GetEpisodes(ctx, tenantID, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load episodes: %w", err)
+	}
+	if episodes[f.Type].Open {
+		return false, nil
+	}
+	if episodes == nil {
+		episodes = make(map[string]Episode)
+	}
+
+	episodes[f.Type] = Episode{Count: 1, Since: at, Open: true, Severity: f.Severity}
+	if err := s.store.PutEpisodes(ctx, tenantID, deviceID, episodes); err != nil {
+		return false, fmt.Errorf("failed to save episodes: %w", err)
+	}
+	return true, nil
+}
+
+// openTypes lists the open conditions, most severe first
+func openTypes(episodes map[string]Episode) []string {
+	open := make([]string, 0, len(episodes))
+	for typ, ep := range episodes {
+		if ep.Open {
+			open = append(open, typ)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		a, b := episodes[open[i]].Severity.Rank(), episodes[open[j]].Severity.Rank()
+		if a != b {
+			return a > b
+		}
+		return open[i] < open[j]
+	})
+	return open
+}
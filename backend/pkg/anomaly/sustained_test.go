@@ -0,0 +1,200 @@
+package anomaly
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// episodeStore keeps episodes in memory for tests
+type episodeStore map[string]map[string]Episode
+
+func (s episodeStore) GetEpisodes(ctx context.Context, tenantID, deviceID string) (map[string]Episode, error) {
+	stored, ok := s[tenantID+"/"+deviceID]
+	if !ok {
+		return nil, nil
+	}
+	episodes := make(map[string]Episode, len(stored))
+	for typ, ep := range stored {
+		episodes[typ] = ep
+	}
+	return episodes, nil
+}
+
+func (s episodeStore) PutEpisodes(ctx context.Context, tenantID, deviceID string, episodes map[string]Episode) error {
+	s[tenantID+"/"+deviceID] = episodes
+	return nil
+}
+
+var sustainStart = time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+
+// step is one reading applied to a device, and what should follow from it
+type step struct {
+	at         int // Seconds after sustainStart
+	hr, spo2   int
+	skipVitals bool
+	report     string // Reported finding types, comma separated
+	open       string // Open conditions after the reading, comma separated
+}
+
+func TestSustainedApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings SustainSettings
+		steps    []step
+	}{
+		{
+			name:     "opens once sustained and clears past recovery",
+			settings: SustainSettings{Readings: 3},
+			steps: []step{
+				{at: 1, hr: 160, spo2: 98},
+				{at: 2, hr: 160, spo2: 98},
+				{at: 3, hr: 160, spo2: 98, report: "tachycardia", open: "tachycardia"},
+				{at: 4, hr: 160, spo2: 98, open: "tachycardia"},
+				{at: 5, hr: 145, spo2: 98, open: "tachycardia"},
+				{at: 6, hr: 140, spo2: 98},
+			},
+		},
+		{
+			name:     "interrupted run starts again",
+			settings: SustainSettings{Readings: 3},
+			steps: []step{
+				{at: 1, hr: 160, spo2: 98},
+				{at: 2, hr: 160, spo2: 98},
+				{at: 3, hr: 100, spo2: 98},
+				{at: 4, hr: 160, spo2: 98},
+				{at: 5, hr: 160, spo2: 98},
+				{at: 6, hr: 160, spo2: 98, report: "tachycardia", open: "tachycardia"},
+			},
+		},
+		{
+			name:     "opens once the window has passed",
+			settings: SustainSettings{Readings: 100, Window: 10 * time.Second},
+			steps: []step{
+				{at: 0, hr: 160, spo2: 98},
+				{at: 5, hr: 160, spo2: 98},
+				{at: 10, hr: 160, spo2: 98, report: "tachycardia", open: "tachycardia"},
+			},
+		},
+		{
+			name:     "critical opens at once",
+			settings: SustainSettings{Readings: 3},
+			steps: []step{
+				{at: 1, hr: 80, spo2: 88, report: "hypoxia", open: "hypoxia"},
+				{at: 2, hr: 80, spo2: 88, open: "hypoxia"},
+			},
+		},
+		{
+			name:     "escalates only when more severe",
+			settings: SustainSettings{Readings: 2},
+			steps: []step{
+				{at: 1, hr: 80, spo2: 93},
+				{at: 2, hr: 80, spo2: 93, report: "hypoxia", open: "hypoxia"},
+				{at: 3, hr: 80, spo2: 88, report: "hypoxia", open: "hypoxia"},
+				{at: 4, hr: 80, spo2: 88, open: "hypoxia"},
+				{at: 5, hr: 80, spo2: 93, open: "hypoxia"},
+				{at: 6, hr: 80, spo2: 94, open: "hypoxia"},
+				{at: 7, hr: 80, spo2: 95},
+			},
+		},
+		{
+			name:     "conditions are tracked separately",
+			settings: SustainSettings{Readings: 2},
+			steps: []step{
+				{at: 1, hr: 160, spo2: 93},
+				{at: 2, hr: 160, spo2: 93, report: "tachycardia,hypoxia", open: "hypoxia,tachycardia"},
+				{at: 3, hr: 100, spo2: 93, open: "hypoxia"},
+			},
+		},
+		{
+			name:     "redelivered reading is not counted twice",
+			settings: SustainSettings{Readings: 3},
+			steps: []step{
+				{at: 1, hr: 160, spo2: 98},
+				{at: 1, hr: 160, spo2: 98},
+				{at: 2, hr: 160, spo2: 98},
+				{at: 2, hr: 160, spo2: 98},
+				{at: 3, hr: 160, spo2: 98, report: "tachycardia", open: "tachycardia"},
+			},
+		},
+		{
+			name:     "late reading does not clear",
+			settings: SustainSettings{Readings: 2},
+			steps: []step{
+				{at: 1, hr: 160, spo2: 98},
+				{at: 3, hr: 160, spo2: 98, report: "tachycardia", open: "tachycardia"},
+				{at: 2, hr: 100, spo2: 98, open: "tachycardia"},
+				{at: 4, hr: 100, spo2: 98},
+			},
+		},
+		{
+			name:     "sensor fault does not clear",
+			settings: SustainSettings{Readings: 2},
+			steps: []step{
+				{at: 1, hr: 160, spo2: 98},
+				{at: 2, hr: 160, spo2: 98, report: "tachycardia", open: "tachycardia"},
+				{at: 3, hr: 100, spo2: 98, skipVitals: true, open: "tachycardia"},
+				{at: 4, hr: 100, spo2: 98},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := NewSimpleDetector()
+			s := NewSustainedDetector(episodeStore{}, detector, tt.settings)
+
+			for i, st := range tt.steps {
+				r := Reading{
+					TenantID:   "acme-clinic",
+					DeviceID:   "patient-001",
+					HeartRate:  st.hr,
+					TempC:      36.8,
+					SpO2:       st.spo2,
+					BatteryPct: 80,
+					SkipVitals: st.skipVitals,
+				}
+				at := sustainStart.Add(time.Duration(st.at) * time.Second)
+				report, open, err := s.Apply(context.Background(), r, at, detector.Detect(r))
+				if err != nil {
+					t.Fatalf("step %d: Apply: %v", i, err)
+				}
+				if got := strings.Join(report.Types(), ","); got != st.report {
+					t.Errorf("step %d: reported %q, want %q", i, got, st.report)
+				}
+				if got := strings.Join(open, ","); got != st.open {
+					t.Errorf("step %d: open %q, want %q", i, got, st.open)
+				}
+			}
+		})
+	}
+}
+
+func TestSustainedOpen(t *testing.T) {
+	detector := NewSimpleDetector()
+	s := NewSustainedDetector(episodeStore{}, detector, DefaultSustainSettings())
+	ctx := context.Background()
+	stale := detector.CheckStale("acme-clinic", time.Minute).Findings[0]
+
+	if opened, err := s.Open(ctx, "acme-clinic", "patient-001", stale, sustainStart); err != nil || !opened {
+		t.Fatalf("Open = %v, %v, want true", opened, err)
+	}
+	if opened, err := s.Open(ctx, "acme-clinic", "patient-001", stale, sustainStart.Add(time.Minute)); err != nil || opened {
+		t.Fatalf("Open of an open condition = %v, %v, want false", opened, err)
+	}
+
+	// The device's next reading ends the silence, even if it was taken
+	// before the silence was reported
+	r := Reading{TenantID: "acme-clinic", DeviceID: "patient-001", HeartRate: 80, TempC: 36.8, SpO2: 98, BatteryPct: 80}
+	_, open, err := s.Apply(ctx, r, sustainStart.Add(-time.Second), detector.Detect(r))
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(open) != 0 {
+		t.Errorf("open after a reading = %v, want none", open)
+	}
+	if opened, err := s.Open(ctx, "acme-clinic", "patient-001", stale, sustainStart.Add(2*time.Minute)); err != nil || !opened {
+		t.Errorf("Open after clearing = %v, %v, want true", opened, err)
+	}
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+)
+
+// BaselineTTL is how long a device's baseline is kept after its last reading
+const BaselineTTL = 30 * 24 * time.Hour
+
+var (
+	_ anomaly.BaselineStore = (*RedisClient)(nil)
+	_ anomaly.BaselineStore = (*MemoryCache)(nil)
+)
+
+func baselineKey(tenantID, deviceID string) string {
+	return fmt.Sprintf("baseline:%s:%s", tenantID, deviceID)
+}
+
+// GetBaseline returns a device's baseline, or nil if it has none
+func (r *RedisClient) GetBaseline(ctx context.Context, tenantID, deviceID string) (*anomaly.Baseline, error) {
+	val, err := r.client.Get(ctx, baselineKey(tenantID, deviceID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get baseline: %w", err)
+	}
+
+	var baseline anomaly.Baseline
+	if err := json.Unmarshal([]byte(val), &baseline); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal baseline: %w", err)
+	}
+	return &baseline, nil
+}
+
+// PutBaseline saves a device's baseline
+func (r *RedisClient) PutBaseline(ctx context.Context, tenantID, deviceID string, baseline anomaly.Baseline) error {
+	data, err := json.Marshal(baseline)
+	if err != nil {
+		return fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+
+	if err := r.client.Set(ctx, baselineKey(tenantID, deviceID), data, BaselineTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set baseline: %w", err)
+	}
+	return nil
+}
+
+// GetBaseline returns a device's baseline, or nil if it has none
+func (m *MemoryCache) GetBaseline(ctx context.Context, tenantID, deviceID string) (*anomaly.Baseline, error) {
+	m.mu.RLock()
+	baseline, ok := m.baselines[baselineKey(tenantID, deviceID)]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+	return &baseline, nil
+}
+
+// PutBaseline saves a device's baseline
+func (m *MemoryCache) PutBaseline(ctx context.Context, tenantID, deviceID string, baseline anomaly.Baseline) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.baselines[baselineKey(tenantID, deviceID)] = baseline
+	return nil
+}
@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrCacheMiss is returned when a device has no cached reading
+var ErrCacheMiss = errors.New("no cached data")
+
+// LatestCache holds the most recent reading for each device
+type LatestCache interface {
+	SetLatest(ctx context.Context, tenantID, deviceID string, data LatestTelemetry) error
+	GetLatest(ctx context.Context, tenantID, deviceID string) (*LatestTelemetry, error)
+	Close() error
+}
+
+var (
+	_ LatestCache = (*RedisClient)(nil)
+	_ LatestCache = (*MemoryCache)(nil)
+)
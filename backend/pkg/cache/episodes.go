@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+)
+
+// EpisodeTTL is how long a device's episodes are kept after its last reading
+const EpisodeTTL = 24 * time.Hour
+
+var (
+	_ anomaly.EpisodeStore = (*RedisClient)(nil)
+	_ anomaly.EpisodeStore = (*MemoryCache)(nil)
+)
+
+func episodesKey(tenantID, deviceID string) string {
+	return fmt.Sprintf("episodes:%s:%s", tenantID, deviceID)
+}
+
+// GetEpisodes returns a device's episodes, or nil if it has none
+func (r *RedisClient) GetEpisodes(ctx context.Context, tenantID, deviceID string) (map[string]anomaly.Episode, error) {
+	val, err := r.client.Get(ctx, episodesKey(tenantID, deviceID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get episodes: %w", err)
+	}
+
+	var episodes map[string]anomaly.Episode
+	if err := json.Unmarshal([]byte(val), &episodes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal episodes: %w", err)
+	}
+	return episodes, nil
+}
+
+// PutEpisodes saves a device's episodes, deleting the key once none are left
+func (r *RedisClient) PutEpisodes(ctx context.Context, tenantID, deviceID string, episodes map[string]anomaly.Episode) error {
+	key := episodesKey(tenantID, deviceID)
+	if len(episodes) == 0 {
+		if err := r.client.Del(ctx, key).Err(); err != nil {
+			return fmt.Errorf("failed to delete episodes: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(episodes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal episodes: %w", err)
+	}
+
+	if err := r.client.Set(ctx, key, data, EpisodeTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set episodes: %w", err)
+	}
+	return nil
+}
+
+// GetEpisodes returns a device's episodes, or nil if it has none
+func (m *MemoryCache) GetEpisodes(ctx context.Context, tenantID, deviceID string) (map[string]anomaly.Episode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.episodes[episodesKey(tenantID, deviceID)]
+	if !ok {
+		return nil, nil
+	}
+
+	// Copy, so the caller can change it without holding the lock
+	episodes := make(map[string]anomaly.Episode, len(stored))
+	for typ, ep := range stored {
+		episodes[typ] = ep
+	}
+	return episodes, nil
+}
+
+// PutEpisodes saves a device's episodes
+func (m *MemoryCache) PutEpisodes(ctx context.Context, tenantID, deviceID string, episodes map[string]anomaly.Episode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := episodesKey(tenantID, deviceID)
+	if len(episodes) == 0 {
+		delete(m.episodes, key)
+		return nil
+	}
+	m.episodes[key] = episodes
+	return nil
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+)
+
+// MemoryCache is a thread-safe, in-process LatestCache with the same expiry
+// behaviour as the Redis cache. It also keeps device baselines and episodes,
+// which never expire.
+type MemoryCache struct {
+	mu        sync.RWMutex
+	entries   map[string]memoryEntry
+	baselines map[string]anomaly.Baseline
+	episodes  map[string]map[string]anomaly.Episode
+}
+
+type memoryEntry struct {
+	data      LatestTelemetry
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates an empty in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries:   make(map[string]memoryEntry),
+		baselines: make(map[string]anomaly.Baseline),
+		episodes:  make(map[string]map[string]anomaly.Episode),
+	}
+}
+
+// SetLatest caches the latest telemetry for a device
+func (m *MemoryCache) SetLatest(ctx context.Context, tenantID, deviceID string, data LatestTelemetry) error {
+	key := fmt.Sprintf("latest:%s:%s", tenantID, deviceID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = memoryEntry{data: data, expiresAt: time.Now().Add(LatestTTL)}
+	return nil
+}
+
+// GetLatest retrieves cached telemetry
+func (m *MemoryCache) GetLatest(ctx context.Context, tenantID, deviceID string) (*LatestTelemetry, error) {
+	key := fmt.Sprintf("latest:%s:%s", tenantID, deviceID)
+
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, fmt.Errorf("%w for device %s", ErrCacheMiss, deviceID)
+	}
+
+	data := entry.data
+	return &data, nil
+}
+
+// Close releases the cache; there is nothing to do in memory
+func (m *MemoryCache) Close() error {
+	return nil
+}
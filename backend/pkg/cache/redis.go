@@ -9,26 +9,35 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// LatestTTL is how long a device's latest reading stays cached
+const LatestTTL = 10 * time.Minute
+
 type RedisClient struct {
 	client *redis.Client
 }
 
 // LatestTelemetry represents cached device data
 type LatestTelemetry struct {
-	DeviceID   string    `json:"device_id"`
-	Timestamp  time.Time `json:"timestamp"`
-	HeartRate  int       `json:"hr_bpm"`
-	TempC      float64   `json:"temp_c"`
-	SpO2       int       `json:"spo2_pct"`
-	Steps      int       `json:"steps"`
-	BatteryPct int       `json:"battery_pct"`
+	DeviceID     string    `json:"device_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	HeartRate    int       `json:"hr_bpm"`
+	TempC        float64   `json:"temp_c"`
+	SpO2         int       `json:"spo2_pct"`
+	Steps        int       `json:"steps"`
+	BatteryPct   int       `json:"battery_pct"`
+	FWVersion    string    `json:"fw_version,omitempty"`
+	AnomalyFlag  bool      `json:"anomaly_flag"`
+	AnomalyType  string    `json:"anomaly_type,omitempty"`
+	QualityFlags []string  `json:"quality_flags,omitempty"`
+	EWSScore     *int      `json:"ews_score,omitempty"` // Early warning score; nil when not scored
+	EWSBand      string    `json:"ews_band,omitempty"`
 }
 
-// NewRedisClient creates a Redis client
-func NewRedisClient(addr string) (*RedisClient, error) {
+// NewRedisClient creates a Redis client. The password may be empty.
+func NewRedisClient(addr, password string) (*RedisClient, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
-		Password: "", // No password for local dev
+		Password: password,
 		DB:       0,
 	})
 
@@ -49,8 +58,7 @@ func (r *RedisClient) SetLatest(ctx context.Context, tenantID, deviceID string,
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	// Cache for 10 minutes
-	err = r.client.Set(ctx, key, jsonData, 10*time.Minute).Err()
+	err = r.client.Set(ctx, key, jsonData, LatestTTL).Err()
 	if err != nil {
 		return fmt.Errorf("failed to set cache: %w", err)
 	}
@@ -64,7 +72,7 @@ func (r *RedisClient) GetLatest(ctx context.Context, tenantID, deviceID string)
 	
 	val, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return nil, fmt.Errorf("no cached data for device %s", deviceID)
+		return nil, fmt.Errorf("%w for device %s", ErrCacheMiss, deviceID)
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to get cache: %w", err)
 	}
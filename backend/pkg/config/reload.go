@@ -0,0 +1,29 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// OnReload reloads the config from path, and the environment, on every
+// SIGHUP and passes it to apply. A config that fails to load is logged and
+// ignored. Only settings that do not need a new connection, such as the log
+// level and detector thresholds, should be applied.
+func OnReload(path string, apply func(*Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			cfg, err := Load(path)
+			if err != nil {
+				log.Printf("Ignoring SIGHUP, failed to reload config: %v", err)
+				continue
+			}
+			apply(cfg)
+			log.Printf("Reloaded config (log level: %s)", cfg.LogLevel)
+		}
+	}()
+}
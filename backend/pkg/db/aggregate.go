@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Metric names used as keys in TelemetryBucket.Metrics
+const (
+	MetricHeartRate  = "hr_bpm"
+	MetricTempC      = "temp_c"
+	MetricSpO2       = "spo2_pct"
+	MetricSteps      = "steps"
+	MetricBatteryPct = "battery_pct"
+)
+
+// AggregateMetrics lists every metric that is aggregated, in display order
+var AggregateMetrics = []string{MetricHeartRate, MetricTempC, MetricSpO2, MetricSteps, MetricBatteryPct}
+
+// MaxAggregateWindow is the widest time range one aggregation may cover
+const MaxAggregateWindow = 31 * 24 * time.Hour
+
+// maxAggregateRecords caps how many readings one aggregation may scan: a full
+// window from a device reporting once a second
+const maxAggregateRecords = int(MaxAggregateWindow / time.Second)
+
+// ErrAggregateTooLarge is returned when an aggregation would scan more
+// readings than the cap allows
+var ErrAggregateTooLarge = errors.New("aggregation scans too many readings")
+
+// MetricStats summarizes a single metric within a bucket
+type MetricStats struct {
+	Min  float64
+	Max  float64
+	Avg  float64
+	Last float64
+
+	sum float64
+}
+
+// TelemetryBucket summarizes the readings in [Start, Start+width)
+type TelemetryBucket struct {
+	Start        time.Time
+	Count        int
+	AnomalyCount int
+	Metrics      map[string]*MetricStats
+}
+
+// bucketAggregator folds readings into fixed-width time buckets
+type bucketAggregator struct {
+	width   time.Duration
+	buckets map[int64]*TelemetryBucket
+}
+
+func newBucketAggregator(width time.Duration) *bucketAggregator {
+	return &bucketAggregator{
+		width:   width,
+		buckets: make(map[int64]*TelemetryBucket),
+	}
+}
+
+// Add folds a reading into its bucket. Readings must be added in ascending
+// timestamp order for Last to be correct.
+func (a *bucketAggregator) Add(record TelemetryRecord) {
+	ts, err := time.Parse(time.RFC3339, record.Timestamp)
+	if err != nil {
+		return
+	}
+
+	start := ts.UTC().Truncate(a.width)
+	bucket, ok := a.buckets[start.Unix()]
+	if !ok {
+		bucket = &TelemetryBucket{
+			Start:   start,
+			Metrics: make(map[string]*MetricStats, len(AggregateMetrics)),
+		}
+		a.buckets[start.Unix()] = bucket
+	}
+
+	bucket.Count++
+	if record.AnomalyFlag {
+		bucket.AnomalyCount++
+	}
+
+	values := map[string]float64{
+		MetricHeartRate:  float64(record.HeartRate),
+		MetricTempC:      record.TempC,
+		MetricSpO2:       float64(record.SpO2),
+		MetricSteps:      float64(record.Steps),
+		MetricBatteryPct: float64(record.BatteryPct),
+	}
+
+	for name, v := range values {
+		stats, ok := bucket.Metrics[name]
+		if !ok {
+			stats = &MetricStats{Min: v, Max: v}
+			bucket.Metrics[name] = stats
+		}
+		if v < stats.Min {
+			stats.Min = v
+		}
+		if v > stats.Max {
+			stats.Max = v
+		}
+		stats.sum += v
+		stats.Avg = stats.sum / float64(bucket.Count)
+		stats.Last = v
+	}
+}
+
+// Buckets returns the non-empty buckets in ascending time order
+func (a *bucketAggregator) Buckets() []TelemetryBucket {
+	result := make([]TelemetryBucket, 0, len(a.buckets))
+	for _, bucket := range a.buckets {
+		result = append(result, *bucket)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+
+	return result
+}
+
+// AggregateTelemetry summarizes a device's readings between from and to
+// into buckets of the given width
+func (d *DynamoDBClient) AggregateTelemetry(ctx context.Context, tenantID, deviceID string, from, to time.Time, width time.Duration) ([]TelemetryBucket, error) {
+	return aggregateQuery(ctx, d, tenantID, deviceID, from, to, width)
+}
+
+// aggregateQuery pages through a range query and folds every reading into
+// buckets, for stores that cannot aggregate natively
+func aggregateQuery(ctx context.Context, store TelemetryStore, tenantID, deviceID string, from, to time.Time, width time.Duration) ([]TelemetryBucket, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid bucket width %v", width)
+	}
+
+	agg := newBucketAggregator(width)
+	opts := QueryOptions{From: from, To: to, Ascending: true}
+	scanned := 0
+
+	for {
+		page, err := store.QueryTelemetry(ctx, tenantID, deviceID, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range page.Records {
+			agg.Add(record)
+		}
+
+		scanned += len(page.Records)
+		if scanned > maxAggregateRecords {
+			return nil, fmt.Errorf("more than %d readings, narrow the time range: %w", maxAggregateRecords, ErrAggregateTooLarge)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	return agg.Buckets(), nil
+}
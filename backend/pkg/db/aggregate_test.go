@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAggregateTelemetry(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	readings := []struct {
+		offset    time.Duration
+		heartRate int
+		anomaly   bool
+	}{
+		{offset: 0, heartRate: 70},
+		{offset: 20 * time.Second, heartRate: 130, anomaly: true},
+		{offset: 40 * time.Second, heartRate: 80},
+		{offset: 3 * time.Minute, heartRate: 90},
+		{offset: 3*time.Minute + 30*time.Second, heartRate: 60},
+		{offset: 2 * time.Hour, heartRate: 100}, // Outside every queried range
+	}
+	for _, r := range readings {
+		record := TelemetryRecord{
+			TenantID:    "acme-clinic",
+			DeviceID:    "patient-001",
+			Timestamp:   base.Add(r.offset).Format(time.RFC3339),
+			HeartRate:   r.heartRate,
+			AnomalyFlag: r.anomaly,
+		}
+		if err := store.PutTelemetry(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type bucket struct {
+		start            time.Duration // Offset from base
+		count, anomalies int
+		min, max, avg    float64
+		last             float64
+	}
+
+	tests := []struct {
+		name  string
+		from  time.Duration
+		to    time.Duration
+		width time.Duration
+		want  []bucket
+	}{
+		{
+			name:  "minute buckets skip empty minutes",
+			to:    time.Hour,
+			width: time.Minute,
+			want: []bucket{
+				{start: 0, count: 3, anomalies: 1, min: 70, max: 130, avg: 280.0 / 3, last: 80},
+				{start: 3 * time.Minute, count: 2, min: 60, max: 90, avg: 75, last: 60},
+			},
+		},
+		{
+			name:  "one wide bucket",
+			to:    time.Hour,
+			width: time.Hour,
+			want: []bucket{
+				{start: 0, count: 5, anomalies: 1, min: 60, max: 130, avg: 86, last: 60},
+			},
+		},
+		{
+			name:  "range starts mid-bucket",
+			from:  30 * time.Second,
+			to:    time.Hour,
+			width: 5 * time.Minute,
+			want: []bucket{
+				{start: 0, count: 3, min: 60, max: 90, avg: 230.0 / 3, last: 60},
+			},
+		},
+		{
+			name:  "no readings",
+			from:  10 * time.Minute,
+			to:    time.Hour,
+			width: time.Minute,
+			want:  []bucket{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.AggregateTelemetry(ctx, "acme-clinic", "patient-001", base.Add(tt.from), base.Add(tt.to), tt.width)
+			if err != nil {
+				t.Fatalf("AggregateTelemetry: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d buckets, want %d", len(got), len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				b := got[i]
+				if !b.Start.Equal(base.Add(want.start)) {
+					t.Errorf("bucket %d starts %v, want %v", i, b.Start, base.Add(want.start))
+				}
+				if b.Count != want.count || b.AnomalyCount != want.anomalies {
+					t.Errorf("bucket %d has %d readings and %d anomalies, want %d and %d", i, b.Count, b.AnomalyCount, want.count, want.anomalies)
+				}
+
+				hr := b.Metrics[MetricHeartRate]
+				if hr == nil {
+					t.Fatalf("bucket %d has no %s stats", i, MetricHeartRate)
+				}
+				if hr.Min != want.min || hr.Max != want.max || hr.Avg != want.avg || hr.Last != want.last {
+					t.Errorf("bucket %d %s = min %v max %v avg %v last %v, want min %v max %v avg %v last %v",
+						i, MetricHeartRate, hr.Min, hr.Max, hr.Avg, hr.Last, want.min, want.max, want.avg, want.last)
+				}
+			}
+		})
+	}
+
+	if _, err := store.AggregateTelemetry(ctx, "acme-clinic", "patient-001", base, base.Add(time.Hour), 0); err == nil {
+		t.Error("AggregateTelemetry accepted a zero bucket width")
+	}
+}
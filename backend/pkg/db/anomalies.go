@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AnomalyEvent is a single detected anomaly with the vitals that caused it.
+// A reading that breaks several rules records one event per finding.
+type AnomalyEvent struct {
+	TenantID    string  `dynamodbav:"tenant_id"`
+	DeviceID    string  `dynamodbav:"device_id"`
+	Timestamp   string  `dynamodbav:"timestamp"`
+	AnomalyType string  `dynamodbav:"anomaly_type"`
+	Reason      string  `dynamodbav:"reason"`
+	Severity    string  `dynamodbav:"severity"`
+	Metric      string  `dynamodbav:"metric,omitempty"`
+	Value       float64 `dynamodbav:"value"`
+	Threshold   float64 `dynamodbav:"threshold"`
+	HeartRate   int     `dynamodbav:"hr_bpm"`
+	TempC       float64 `dynamodbav:"temp_c"`
+	SpO2        int     `dynamodbav:"spo2_pct"`
+}
+
+// AnomalyQuery filters a tenant's anomaly history. Empty fields match
+// everything.
+type AnomalyQuery struct {
+	DeviceID    string
+	AnomalyType string
+	From        time.Time
+	To          time.Time
+	Limit       int32
+	Cursor      string // Opaque cursor from a previous AnomalyPage
+}
+
+// AnomalyPage is a single page of anomaly events, newest first
+type AnomalyPage struct {
+	Events     []AnomalyEvent
+	NextCursor string // Empty when there are no more pages
+}
+
+// Anomaly events are indexed by tenant and time:
+// Partition Key: TENANT#tenant_id#ANOMALY
+// Sort Key: TS#timestamp#DEVICE#device_id#anomaly_type
+func anomalyPK(tenantID string) string {
+	return fmt.Sprintf("TENANT#%s#ANOMALY", tenantID)
+}
+
+func anomalySK(event AnomalyEvent) string {
+	return fmt.Sprintf("TS#%s#DEVICE#%s#%s", event.Timestamp, event.DeviceID, event.AnomalyType)
+}
+
+// PutAnomaly records an anomaly event, expiring it with the tenant's anomaly
+// retention
+func (d *DynamoDBClient) PutAnomaly(ctx context.Context, event AnomalyEvent) error {
+	ttl, err := d.expiresAt(ctx, event.TenantID, event.Timestamp, true)
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal anomaly: %w", err)
+	}
+
+	item["PK"] = &types.AttributeValueMemberS{Value: anomalyPK(event.TenantID)}
+	item["SK"] = &types.AttributeValueMemberS{Value: anomalySK(event)}
+	item["ttl"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", ttl)}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put anomaly: %w", err)
+	}
+
+	return nil
+}
+
+// QueryAnomalies returns one page of a tenant's anomaly events, newest
+// first. Device and type filters are applied after the key range is read,
+// so a page may hold fewer than Limit events even when more exist.
+func (d *DynamoDBClient) QueryAnomalies(ctx context.Context, tenantID string, q AnomalyQuery) (*AnomalyPage, error) {
+	pk := anomalyPK(tenantID)
+	from, to := sortKeyRange(q.From, q.To)
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(d.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND SK BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":   &types.AttributeValueMemberS{Value: pk},
+			":from": &types.AttributeValueMemberS{Value: from},
+			":to":   &types.AttributeValueMemberS{Value: to},
+		},
+		ScanIndexForward: aws.Bool(false), // Newest first
+	}
+
+	filter := ""
+	if q.DeviceID != "" {
+		filter = "device_id = :device"
+		input.ExpressionAttributeValues[":device"] = &types.AttributeValueMemberS{Value: q.DeviceID}
+	}
+	if q.AnomalyType != "" {
+		if filter != "" {
+			filter += " AND "
+		}
+		filter += "anomaly_type = :type"
+		input.ExpressionAttributeValues[":type"] = &types.AttributeValueMemberS{Value: q.AnomalyType}
+	}
+	if filter != "" {
+		input.FilterExpression = aws.String(filter)
+	}
+
+	if q.Limit > 0 {
+		input.Limit = aws.Int32(q.Limit)
+	}
+
+	if q.Cursor != "" {
+		key, err := decodeCursor(q.Cursor, pk)
+		if err != nil {
+			return nil, err
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: key.PK},
+			"SK": &types.AttributeValueMemberS{Value: key.SK},
+		}
+	}
+
+	output, err := d.client.Query(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomalies: %w", err)
+	}
+
+	events := make([]AnomalyEvent, 0, len(output.Items))
+	if err := attributevalue.UnmarshalListOfMaps(output.Items, &events); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal anomalies: %w", err)
+	}
+
+	page := &AnomalyPage{Events: events}
+
+	if len(output.LastEvaluatedKey) > 0 {
+		var key cursorKey
+		if err := attributevalue.UnmarshalMap(output.LastEvaluatedKey, &key); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal last evaluated key: %w", err)
+		}
+		cursor, err := encodeCursor(key)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor
+	}
+
+	return page, nil
+}
@@ -0,0 +1,367 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxBatchItems is the BatchWriteItem limit per request
+const maxBatchItems = 25
+
+// ErrBatchWriterClosed is returned by Add after Close has been called
+var ErrBatchWriterClosed = errors.New("batch writer closed")
+
+// BatchWriterConfig tunes a BatchWriter. Zero values use the defaults.
+type BatchWriterConfig struct {
+	MaxLinger  time.Duration // Flush a partial batch after this long (default 100ms)
+	MaxRetries int           // Retries for failed requests and unprocessed items (default 5)
+	Flushers   int           // Concurrent BatchWriteItem calls (default 4)
+	BufferSize int           // Records queued before Add blocks (default 1000)
+	Timeout    time.Duration // Timeout for each BatchWriteItem call (default 10s)
+
+	// OnFailure is called once for every record that could not be written
+	// after all retries, with its anomaly events, which were not written
+	// either, and the attempts made for it in all, including those made
+	// before it was added. It may be called from several goroutines at once.
+	OnFailure func(record TelemetryRecord, events []AnomalyEvent, attempts int, err error)
+}
+
+// BatchWriter buffers telemetry records and writes them with BatchWriteItem,
+// flushing at 25 items or after MaxLinger, whichever comes first
+type BatchWriter struct {
+	client *DynamoDBClient
+	cfg    BatchWriterConfig
+
+	mu      sync.RWMutex // guards closed against sends on records
+	closed  bool
+	records chan pendingWrite
+	done    chan struct{}
+	sem     chan struct{}
+	wg      sync.WaitGroup
+
+	// ctx is cancelled when CloseContext gives up, failing outstanding writes
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	queued     atomic.Int64
+	written    atomic.Int64
+	failed     atomic.Int64
+	duplicates atomic.Int64
+}
+
+// pendingWrite is a queued record, its table item and the anomaly events to
+// write once it is stored
+type pendingWrite struct {
+	record   TelemetryRecord
+	item     map[string]types.AttributeValue
+	events   []AnomalyEvent
+	attempts int // Made before the record was added
+}
+
+// NewBatchWriter starts a batch writer for the client's table
+func NewBatchWriter(client *DynamoDBClient, cfg BatchWriterConfig) *BatchWriter {
+	if cfg.MaxLinger <= 0 {
+		cfg.MaxLinger = 100 * time.Millisecond
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+	if cfg.Flushers <= 0 {
+		cfg.Flushers = 4
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &BatchWriter{
+		client:  client,
+		cfg:     cfg,
+		records: make(chan pendingWrite, cfg.BufferSize),
+		done:    make(chan struct{}),
+		sem:     make(chan struct{}, cfg.Flushers),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Add queues a record for writing, given the attempts already made to store
+// it, e.g. before it went to the DLQ. Its anomaly events are written once the
+// record is, so no event refers to a reading that was never stored. Add
+// blocks while the buffer is full, which applies backpressure to the caller.
+// The record's expiry is fixed here from the tenant's retention policy.
+func (w *BatchWriter) Add(ctx context.Context, record TelemetryRecord, events []AnomalyEvent, attempts int) error {
+	ttl, err := w.client.expiresAt(ctx, record.TenantID, record.Timestamp, record.AnomalyFlag)
+	if err != nil {
+		return err
+	}
+	pending := pendingWrite{record: record, item: telemetryItem(record, ttl), events: events, attempts: attempts}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+
+	select {
+	case w.records <- pending:
+		w.queued.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes everything queued and waits for in-flight writes to finish.
+// No records may be added after Close is called.
+func (w *BatchWriter) Close() {
+	w.CloseContext(context.Background())
+}
+
+// CloseContext is Close with a deadline. If ctx is done first, the remaining
+// writes are cancelled, so they are reported through OnFailure instead of
+// being retried, and ctx's error is returned. Close can then be used to wait
+// for the cancelled writes to be reported.
+func (w *BatchWriter) CloseContext(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.records)
+	}
+	w.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		<-w.done
+		w.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		return ctx.Err()
+	}
+}
+
+// Stats returns the number of records written and failed so far
+func (w *BatchWriter) Stats() (written, failed int64) {
+	return w.written.Load(), w.failed.Load()
+}
+
+// Pending returns the number of queued records that have not yet been
+// written, failed or dropped as duplicates
+func (w *BatchWriter) Pending() int64 {
+	return w.queued.Load() - w.written.Load() - w.failed.Load() - w.duplicates.Load()
+}
+
+// Duplicates returns the number of records dropped because a reading with
+// the same key was already queued in the same batch. BatchWriteItem cannot
+// make conditional writes, so readings that need duplicate detection, those
+// with a msg_id or seq, should be written with PutTelemetry instead.
+func (w *BatchWriter) Duplicates() int64 {
+	return w.duplicates.Load()
+}
+
+// run accumulates records into batches and hands full or lingering batches
+// to a flusher
+func (w *BatchWriter) run() {
+	defer close(w.done)
+
+	batch := make([]pendingWrite, 0, maxBatchItems)
+	timer := time.NewTimer(w.cfg.MaxLinger)
+	timer.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		timer.Stop()
+
+		w.sem <- struct{}{}
+		w.wg.Add(1)
+		go func(batch []pendingWrite) {
+			defer func() {
+				<-w.sem
+				w.wg.Done()
+			}()
+			w.writeBatch(batch)
+		}(batch)
+
+		batch = make([]pendingWrite, 0, maxBatchItems)
+	}
+
+	for {
+		select {
+		case pending, ok := <-w.records:
+			if !ok {
+				flush()
+				return
+			}
+
+			if len(batch) == 0 {
+				timer.Reset(w.cfg.MaxLinger)
+			}
+			var added bool
+			if batch, added = addPending(batch, pending); !added {
+				w.duplicates.Add(1)
+			}
+
+			if len(batch) == maxBatchItems {
+				flush()
+			}
+
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// addPending appends a write to the batch. A write with the same key as one
+// already in the batch is a duplicate and is dropped, since BatchWriteItem
+// rejects duplicate keys in a single request.
+func addPending(batch []pendingWrite, pending pendingWrite) ([]pendingWrite, bool) {
+	key := batchKey(pending.item)
+
+	for i := range batch {
+		if batchKey(batch[i].item) == key {
+			return batch, false
+		}
+	}
+
+	return append(batch, pending), true
+}
+
+func batchKey(item map[string]types.AttributeValue) string {
+	pk, _ := item["PK"].(*types.AttributeValueMemberS)
+	sk, _ := item["SK"].(*types.AttributeValueMemberS)
+	if pk == nil || sk == nil {
+		return ""
+	}
+	return pk.Value + "|" + sk.Value
+}
+
+// writeBatch sends one batch, retrying failed requests and unprocessed items
+// with exponential backoff, and reports records that never made it
+func (w *BatchWriter) writeBatch(batch []pendingWrite) {
+	byKey := make(map[string]pendingWrite, len(batch))
+	requests := make([]types.WriteRequest, 0, len(batch))
+
+	for _, pending := range batch {
+		byKey[batchKey(pending.item)] = pending
+		requests = append(requests, types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: pending.item},
+		})
+	}
+
+	var lastErr error
+	tries := 0
+
+	for attempt := 0; attempt <= w.cfg.MaxRetries && len(requests) > 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(batchBackoff(attempt)):
+			case <-w.ctx.Done():
+			}
+		}
+		if err := w.ctx.Err(); err != nil {
+			lastErr = fmt.Errorf("batch write abandoned: %w", err)
+			break
+		}
+
+		tries++
+		ctx, cancel := context.WithTimeout(w.ctx, w.cfg.Timeout)
+		output, err := w.client.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				w.client.tableName: requests,
+			},
+		})
+		cancel()
+		if err != nil {
+			lastErr = fmt.Errorf("failed to batch write: %w", err)
+			continue
+		}
+
+		unprocessed := output.UnprocessedItems[w.client.tableName]
+		w.written.Add(int64(len(requests) - len(unprocessed)))
+		w.writeEvents(byKey, requests, unprocessed)
+		requests = unprocessed
+		lastErr = fmt.Errorf("%d items left unprocessed after %d attempts", len(unprocessed), attempt+1)
+	}
+
+	if len(requests) == 0 {
+		return
+	}
+
+	log.Printf("Batch write gave up on %d records: %v", len(requests), lastErr)
+
+	for _, req := range requests {
+		if req.PutRequest == nil {
+			continue
+		}
+		pending := byKey[batchKey(req.PutRequest.Item)]
+		w.failed.Add(1)
+		if w.cfg.OnFailure != nil {
+			w.cfg.OnFailure(pending.record, pending.events, pending.attempts+tries, lastErr)
+		}
+	}
+}
+
+// writeEvents stores the anomaly events of the records in sent that were
+// written, i.e. not left unprocessed
+func (w *BatchWriter) writeEvents(byKey map[string]pendingWrite, sent, unprocessed []types.WriteRequest) {
+	left := make(map[string]bool, len(unprocessed))
+	for _, req := range unprocessed {
+		if req.PutRequest != nil {
+			left[batchKey(req.PutRequest.Item)] = true
+		}
+	}
+
+	for _, req := range sent {
+		if req.PutRequest == nil {
+			continue
+		}
+		key := batchKey(req.PutRequest.Item)
+		if left[key] {
+			continue
+		}
+		for _, event := range byKey[key].events {
+			ctx, cancel := context.WithTimeout(w.ctx, w.cfg.Timeout)
+			err := w.client.PutAnomaly(ctx, event)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to store %s anomaly: %v", event.AnomalyType, err)
+			}
+		}
+	}
+}
+
+// batchBackoff returns the delay before the given retry attempt: 50ms
+// doubling up to 5s, with jitter
+func batchBackoff(attempt int) time.Duration {
+	delay := 50 * time.Millisecond << uint(attempt-1)
+	if delay > 5*time.Second {
+		delay = 5 * time.Second
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
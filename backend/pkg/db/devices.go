@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Device lifecycle states
+const (
+	DeviceStatusActive   = "active"
+	DeviceStatusInactive = "inactive"
+	DeviceStatusRetired  = "retired"
+)
+
+var (
+	// ErrDeviceNotFound is returned when a device is not in the registry
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceExists is returned when registering a device that already exists
+	ErrDeviceExists = errors.New("device already registered")
+)
+
+// Device is a registry entry describing a wearable and its assignment
+type Device struct {
+	TenantID  string `dynamodbav:"tenant_id"`
+	DeviceID  string `dynamodbav:"device_id"`
+	Model     string `dynamodbav:"model"`
+	FWVersion string `dynamodbav:"fw_version"`
+	PatientID string `dynamodbav:"patient_id"`
+	Ward      string `dynamodbav:"ward"`
+	Status    string `dynamodbav:"status"`
+	CreatedAt string `dynamodbav:"created_at"`
+	UpdatedAt string `dynamodbav:"updated_at"`
+}
+
+// ValidDeviceStatus reports whether status is a known device state
+func ValidDeviceStatus(status string) bool {
+	switch status {
+	case DeviceStatusActive, DeviceStatusInactive, DeviceStatusRetired:
+		return true
+	}
+	return false
+}
+
+// Registry items share the telemetry table:
+// Partition Key: TENANT#tenant_id
+// Sort Key: DEVICE#device_id
+func devicePK(tenantID string) string {
+	return fmt.Sprintf("TENANT#%s", tenantID)
+}
+
+func deviceSK(deviceID string) string {
+	return fmt.Sprintf("DEVICE#%s", deviceID)
+}
+
+func deviceItem(device Device) (map[string]types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMap(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal device: %w", err)
+	}
+
+	item["PK"] = &types.AttributeValueMemberS{Value: devicePK(device.TenantID)}
+	item["SK"] = &types.AttributeValueMemberS{Value: deviceSK(device.DeviceID)}
+
+	return item, nil
+}
+
+// CreateDevice adds a device to the registry and returns the stored entry,
+// failing with ErrDeviceExists if it is already registered
+func (d *DynamoDBClient) CreateDevice(ctx context.Context, device Device) (*Device, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	device.CreatedAt = now
+	device.UpdatedAt = now
+	if device.Status == "" {
+		device.Status = DeviceStatusActive
+	}
+
+	item, err := deviceItem(device)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return nil, ErrDeviceExists
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to put device: %w", err)
+	}
+
+	return &device, nil
+}
+
+// GetDevice retrieves a single registry entry
+func (d *DynamoDBClient) GetDevice(ctx context.Context, tenantID, deviceID string) (*Device, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: devicePK(tenantID)},
+			"SK": &types.AttributeValueMemberS{Value: deviceSK(deviceID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, ErrDeviceNotFound
+	}
+
+	var device Device
+	if err := attributevalue.UnmarshalMap(result.Item, &device); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device: %w", err)
+	}
+
+	return &device, nil
+}
+
+// ListDevices returns every registered device for a tenant
+func (d *DynamoDBClient) ListDevices(ctx context.Context, tenantID string) ([]Device, error) {
+	devices := make([]Device, 0)
+
+	paginator := dynamodb.NewQueryPaginator(d.client, &dynamodb.QueryInput{
+		TableName:              aws.String(d.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":     &types.AttributeValueMemberS{Value: devicePK(tenantID)},
+			":prefix": &types.AttributeValueMemberS{Value: "DEVICE#"},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list devices: %w", err)
+		}
+
+		var batch []Device
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal devices: %w", err)
+		}
+		devices = append(devices, batch...)
+	}
+
+	return devices, nil
+}
+
+// UpdateDevice replaces an existing registry entry and returns the stored
+// entry, failing with ErrDeviceNotFound if the device is not registered
+func (d *DynamoDBClient) UpdateDevice(ctx context.Context, device Device) (*Device, error) {
+	device.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := deviceItem(device)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+	})
+
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return nil, ErrDeviceNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to update device: %w", err)
+	}
+
+	return &device, nil
+}
+
+// DeleteDevice removes a device from the registry. Its telemetry is kept
+// until it expires.
+func (d *DynamoDBClient) DeleteDevice(ctx context.Context, tenantID, deviceID string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: devicePK(tenantID)},
+			"SK": &types.AttributeValueMemberS{Value: deviceSK(deviceID)},
+		},
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+	})
+
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return ErrDeviceNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+
+	return nil
+}
@@ -2,35 +2,49 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+var (
+	// ErrNoTelemetry is returned when a device has no stored readings
+	ErrNoTelemetry = errors.New("no telemetry found")
+	// ErrDuplicateReading is returned when a reading has already been stored
+	ErrDuplicateReading = errors.New("duplicate telemetry reading")
+)
+
 type DynamoDBClient struct {
 	client    *dynamodb.Client
 	tableName string
+	retention *retentionCache
 }
 
 // Telemetry record structure
 type TelemetryRecord struct {
-	TenantID    string
-	DeviceID    string
-	Timestamp   string
-	HeartRate   int
-	TempC       float64
-	SpO2        int
-	Steps       int
-	BatteryPct  int
-	FWVersion   string
-	AnomalyFlag bool
-	AnomalyType string
+	TenantID     string   `dynamodbav:"tenant_id"`
+	DeviceID     string   `dynamodbav:"device_id"`
+	Timestamp    string   `dynamodbav:"timestamp"`
+	HeartRate    int      `dynamodbav:"hr_bpm"`
+	TempC        float64  `dynamodbav:"temp_c"`
+	SpO2         int      `dynamodbav:"spo2_pct"`
+	Steps        int      `dynamodbav:"steps"`
+	BatteryPct   int      `dynamodbav:"battery_pct"`
+	FWVersion    string   `dynamodbav:"fw_version"`
+	AnomalyFlag  bool     `dynamodbav:"anomaly_flag"`
+	AnomalyType  string   `dynamodbav:"anomaly_type,omitempty"`
+	MessageID    string   `dynamodbav:"msg_id,omitempty"`
+	Seq          int64    `dynamodbav:"seq,omitempty"`
+	QualityFlags []string `dynamodbav:"quality_flags,omitempty,stringset"`
+	EWSScore     *int     `dynamodbav:"ews_score,omitempty"` // Early warning score; nil when not scored
+	EWSBand      string   `dynamodbav:"ews_band,omitempty"`
 }
 
 // NewDynamoDBClient creates a new DynamoDB client
@@ -59,25 +73,53 @@ func NewDynamoDBClient(ctx context.Context, endpoint, region, tableName string)
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	client := dynamodb.NewFromConfig(cfg)
-
 	log.Printf("DynamoDB client initialized (table: %s, endpoint: %s)", tableName, endpoint)
 
+	return NewDynamoDBClientFromConfig(cfg, tableName), nil
+}
+
+// NewDynamoDBClientFromConfig creates a client from an already loaded AWS
+// config, as in the Lambda processor
+func NewDynamoDBClientFromConfig(cfg aws.Config, tableName string) *DynamoDBClient {
 	return &DynamoDBClient{
-		client:    client,
+		client:    dynamodb.NewFromConfig(cfg),
 		tableName: tableName,
-	}, nil
+		retention: newRetentionCache(),
+	}
 }
 
-// PutTelemetry stores a telemetry record
+// PutTelemetry stores a telemetry record, expiring it according to the
+// tenant's retention policy. A reading that is already stored is left
+// untouched and ErrDuplicateReading is returned.
 func (d *DynamoDBClient) PutTelemetry(ctx context.Context, record TelemetryRecord) error {
-	// Partition Key: TENANT#tenant_id#DEVICE#device_id
-	// Sort Key: TS#timestamp
-	pk := fmt.Sprintf("TENANT#%s#DEVICE#%s", record.TenantID, record.DeviceID)
-	sk := fmt.Sprintf("TS#%s", record.Timestamp)
+	ttl, err := d.expiresAt(ctx, record.TenantID, record.Timestamp, record.AnomalyFlag)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                telemetryItem(record, ttl),
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return ErrDuplicateReading
+	} else if err != nil {
+		return fmt.Errorf("failed to put item: %w", err)
+	}
 
-	// TTL: 30 days from now (Unix timestamp)
-	ttl := time.Now().Add(30 * 24 * time.Hour).Unix()
+	return nil
+}
+
+// telemetryItem builds the table item for a reading that expires at ttl
+// (Unix seconds)
+func telemetryItem(record TelemetryRecord, ttl int64) map[string]types.AttributeValue {
+	// Partition Key: TENANT#tenant_id#DEVICE#device_id
+	// Sort Key: TS#timestamp#message_key
+	pk := telemetryPK(record.TenantID, record.DeviceID)
+	sk := recordSK(record)
 
 	item := map[string]types.AttributeValue{
 		"PK":           &types.AttributeValueMemberS{Value: pk},
@@ -98,22 +140,26 @@ func (d *DynamoDBClient) PutTelemetry(ctx context.Context, record TelemetryRecor
 	if record.AnomalyType != "" {
 		item["anomaly_type"] = &types.AttributeValueMemberS{Value: record.AnomalyType}
 	}
-
-	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(d.tableName),
-		Item:      item,
-	})
-
-	if err != nil {
-		return fmt.Errorf("failed to put item: %w", err)
+	if record.MessageID != "" {
+		item["msg_id"] = &types.AttributeValueMemberS{Value: record.MessageID}
+	}
+	if record.Seq > 0 {
+		item["seq"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", record.Seq)}
+	}
+	if len(record.QualityFlags) > 0 {
+		item["quality_flags"] = &types.AttributeValueMemberSS{Value: record.QualityFlags}
+	}
+	if record.EWSScore != nil {
+		item["ews_score"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", *record.EWSScore)}
+		item["ews_band"] = &types.AttributeValueMemberS{Value: record.EWSBand}
 	}
 
-	return nil
+	return item
 }
 
 // GetLatestTelemetry retrieves the most recent reading for a device
 func (d *DynamoDBClient) GetLatestTelemetry(ctx context.Context, tenantID, deviceID string) (*TelemetryRecord, error) {
-	pk := fmt.Sprintf("TENANT#%s#DEVICE#%s", tenantID, deviceID)
+	pk := telemetryPK(tenantID, deviceID)
 
 	result, err := d.client.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(d.tableName),
@@ -130,16 +176,72 @@ func (d *DynamoDBClient) GetLatestTelemetry(ctx context.Context, tenantID, devic
 	}
 
 	if len(result.Items) == 0 {
-		return nil, fmt.Errorf("no data found for device %s", deviceID)
-	}
-
-	// Parse the result (simplified - production code would be more robust)
-	item := result.Items[0]
-	
-	return &TelemetryRecord{
-		TenantID:  tenantID,
-		DeviceID:  deviceID,
-		Timestamp: item["timestamp"].(*types.AttributeValueMemberS).Value,
-		// Add more fields as needed
-	}, nil
-}
\ No newline at end of file
+		return nil, ErrNoTelemetry
+	}
+
+	var record TelemetryRecord
+	if err := attributevalue.UnmarshalMap(result.Items[0], &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+
+	return &record, nil
+}
+
+// QueryTelemetry returns one page of a device's readings between opts.From
+// and opts.To (inclusive), ordered by timestamp
+func (d *DynamoDBClient) QueryTelemetry(ctx context.Context, tenantID, deviceID string, opts QueryOptions) (*QueryResult, error) {
+	pk := telemetryPK(tenantID, deviceID)
+	from, to := sortKeyRange(opts.From, opts.To)
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(d.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND SK BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":   &types.AttributeValueMemberS{Value: pk},
+			":from": &types.AttributeValueMemberS{Value: from},
+			":to":   &types.AttributeValueMemberS{Value: to},
+		},
+		ScanIndexForward: aws.Bool(opts.Ascending),
+	}
+
+	if opts.Limit > 0 {
+		input.Limit = aws.Int32(opts.Limit)
+	}
+
+	if opts.Cursor != "" {
+		key, err := decodeCursor(opts.Cursor, pk)
+		if err != nil {
+			return nil, err
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: key.PK},
+			"SK": &types.AttributeValueMemberS{Value: key.SK},
+		}
+	}
+
+	output, err := d.client.Query(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query: %w", err)
+	}
+
+	records := make([]TelemetryRecord, 0, len(output.Items))
+	if err := attributevalue.UnmarshalListOfMaps(output.Items, &records); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal items: %w", err)
+	}
+
+	result := &QueryResult{Records: records}
+
+	if len(output.LastEvaluatedKey) > 0 {
+		var key cursorKey
+		if err := attributevalue.UnmarshalMap(output.LastEvaluatedKey, &key); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal last evaluated key: %w", err)
+		}
+		cursor, err := encodeCursor(key)
+		if err != nil {
+			return nil, err
+		}
+		result.NextCursor = cursor
+	}
+
+	return result, nil
+}
@@ -0,0 +1,316 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a thread-safe, in-process Store for demos and tests. It
+// keeps the same key layout and ordering semantics as the DynamoDB table,
+// but nothing survives a restart. Retention policies are stored but never
+// expire data.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	telemetry map[string][]memoryItem      // PK -> items sorted by SK
+	devices   map[string]map[string]Device // tenant_id -> device_id -> device
+	anomalies map[string][]memoryAnomaly   // PK -> events sorted by SK
+	retention map[string]RetentionPolicy   // tenant_id -> policy
+}
+
+type memoryAnomaly struct {
+	sk    string
+	event AnomalyEvent
+}
+
+type memoryItem struct {
+	sk     string
+	record TelemetryRecord
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		telemetry: make(map[string][]memoryItem),
+		devices:   make(map[string]map[string]Device),
+		anomalies: make(map[string][]memoryAnomaly),
+		retention: make(map[string]RetentionPolicy),
+	}
+}
+
+// PutTelemetry stores a telemetry record, returning ErrDuplicateReading if
+// a reading with the same sort key is already stored
+func (m *MemoryStore) PutTelemetry(ctx context.Context, record TelemetryRecord) error {
+	pk := telemetryPK(record.TenantID, record.DeviceID)
+	sk := recordSK(record)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := m.telemetry[pk]
+	i := sort.Search(len(items), func(i int) bool { return items[i].sk >= sk })
+	if i < len(items) && items[i].sk == sk {
+		return ErrDuplicateReading
+	}
+
+	items = append(items, memoryItem{})
+	copy(items[i+1:], items[i:])
+	items[i] = memoryItem{sk: sk, record: record}
+	m.telemetry[pk] = items
+
+	return nil
+}
+
+// GetLatestTelemetry retrieves the most recent reading for a device
+func (m *MemoryStore) GetLatestTelemetry(ctx context.Context, tenantID, deviceID string) (*TelemetryRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := m.telemetry[telemetryPK(tenantID, deviceID)]
+	if len(items) == 0 {
+		return nil, ErrNoTelemetry
+	}
+
+	record := items[len(items)-1].record
+	return &record, nil
+}
+
+// QueryTelemetry returns one page of a device's readings between opts.From
+// and opts.To (inclusive), ordered by timestamp
+func (m *MemoryStore) QueryTelemetry(ctx context.Context, tenantID, deviceID string, opts QueryOptions) (*QueryResult, error) {
+	pk := telemetryPK(tenantID, deviceID)
+	from, to := sortKeyRange(opts.From, opts.To)
+
+	var start string
+	if opts.Cursor != "" {
+		key, err := decodeCursor(opts.Cursor, pk)
+		if err != nil {
+			return nil, err
+		}
+		start = key.SK
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Collect the matching range in the requested order, resuming after
+	// the cursor key (exclusive)
+	matched := make([]memoryItem, 0)
+	for _, item := range m.telemetry[pk] {
+		if item.sk < from || item.sk > to {
+			continue
+		}
+		if start != "" && ((opts.Ascending && item.sk <= start) || (!opts.Ascending && item.sk >= start)) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+	if !opts.Ascending {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	result := &QueryResult{Records: make([]TelemetryRecord, 0)}
+
+	for i, item := range matched {
+		if opts.Limit > 0 && i == int(opts.Limit) {
+			cursor, err := encodeCursor(cursorKey{PK: pk, SK: matched[i-1].sk})
+			if err != nil {
+				return nil, err
+			}
+			result.NextCursor = cursor
+			break
+		}
+		result.Records = append(result.Records, item.record)
+	}
+
+	return result, nil
+}
+
+// AggregateTelemetry summarizes a device's readings between from and to
+// into buckets of the given width
+func (m *MemoryStore) AggregateTelemetry(ctx context.Context, tenantID, deviceID string, from, to time.Time, width time.Duration) ([]TelemetryBucket, error) {
+	return aggregateQuery(ctx, m, tenantID, deviceID, from, to, width)
+}
+
+// CreateDevice adds a device to the registry and returns the stored entry,
+// failing with ErrDeviceExists if it is already registered
+func (m *MemoryStore) CreateDevice(ctx context.Context, device Device) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tenant := m.devices[device.TenantID]
+	if tenant == nil {
+		tenant = make(map[string]Device)
+		m.devices[device.TenantID] = tenant
+	}
+	if _, ok := tenant[device.DeviceID]; ok {
+		return nil, ErrDeviceExists
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	device.CreatedAt = now
+	device.UpdatedAt = now
+	if device.Status == "" {
+		device.Status = DeviceStatusActive
+	}
+
+	tenant[device.DeviceID] = device
+	return &device, nil
+}
+
+// GetDevice retrieves a single registry entry
+func (m *MemoryStore) GetDevice(ctx context.Context, tenantID, deviceID string) (*Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	device, ok := m.devices[tenantID][deviceID]
+	if !ok {
+		return nil, ErrDeviceNotFound
+	}
+
+	return &device, nil
+}
+
+// ListDevices returns every registered device for a tenant, ordered by ID
+func (m *MemoryStore) ListDevices(ctx context.Context, tenantID string) ([]Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make([]Device, 0, len(m.devices[tenantID]))
+	for _, device := range m.devices[tenantID] {
+		devices = append(devices, device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].DeviceID < devices[j].DeviceID
+	})
+
+	return devices, nil
+}
+
+// UpdateDevice replaces an existing registry entry and returns the stored
+// entry, failing with ErrDeviceNotFound if the device is not registered
+func (m *MemoryStore) UpdateDevice(ctx context.Context, device Device) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.devices[device.TenantID][device.DeviceID]; !ok {
+		return nil, ErrDeviceNotFound
+	}
+
+	device.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	m.devices[device.TenantID][device.DeviceID] = device
+
+	return &device, nil
+}
+
+// DeleteDevice removes a device from the registry
+func (m *MemoryStore) DeleteDevice(ctx context.Context, tenantID, deviceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.devices[tenantID][deviceID]; !ok {
+		return ErrDeviceNotFound
+	}
+
+	delete(m.devices[tenantID], deviceID)
+	return nil
+}
+
+// PutAnomaly records an anomaly event
+func (m *MemoryStore) PutAnomaly(ctx context.Context, event AnomalyEvent) error {
+	pk := anomalyPK(event.TenantID)
+	sk := anomalySK(event)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.anomalies[pk]
+	i := sort.Search(len(events), func(i int) bool { return events[i].sk >= sk })
+	if i < len(events) && events[i].sk == sk {
+		events[i].event = event
+		return nil
+	}
+
+	events = append(events, memoryAnomaly{})
+	copy(events[i+1:], events[i:])
+	events[i] = memoryAnomaly{sk: sk, event: event}
+	m.anomalies[pk] = events
+
+	return nil
+}
+
+// QueryAnomalies returns one page of a tenant's anomaly events, newest first
+func (m *MemoryStore) QueryAnomalies(ctx context.Context, tenantID string, q AnomalyQuery) (*AnomalyPage, error) {
+	pk := anomalyPK(tenantID)
+	from, to := sortKeyRange(q.From, q.To)
+
+	var start string
+	if q.Cursor != "" {
+		key, err := decodeCursor(q.Cursor, pk)
+		if err != nil {
+			return nil, err
+		}
+		start = key.SK
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	page := &AnomalyPage{Events: make([]AnomalyEvent, 0)}
+
+	events := m.anomalies[pk]
+	for i := len(events) - 1; i >= 0; i-- {
+		item := events[i]
+		if item.sk < from || item.sk > to || (start != "" && item.sk >= start) {
+			continue
+		}
+		if (q.DeviceID != "" && item.event.DeviceID != q.DeviceID) ||
+			(q.AnomalyType != "" && item.event.AnomalyType != q.AnomalyType) {
+			continue
+		}
+
+		if q.Limit > 0 && len(page.Events) == int(q.Limit) {
+			cursor, err := encodeCursor(cursorKey{PK: pk, SK: anomalySK(page.Events[len(page.Events)-1])})
+			if err != nil {
+				return nil, err
+			}
+			page.NextCursor = cursor
+			break
+		}
+		page.Events = append(page.Events, item.event)
+	}
+
+	return page, nil
+}
+
+// GetRetentionPolicy returns a tenant's retention policy, or the default
+// policy if none has been set
+func (m *MemoryStore) GetRetentionPolicy(ctx context.Context, tenantID string) (*RetentionPolicy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	policy, ok := m.retention[tenantID]
+	if !ok {
+		policy = DefaultRetentionPolicy(tenantID)
+	}
+
+	return &policy, nil
+}
+
+// PutRetentionPolicy sets a tenant's retention policy
+func (m *MemoryStore) PutRetentionPolicy(ctx context.Context, policy RetentionPolicy) (*RetentionPolicy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retention[policy.TenantID] = policy
+	return &policy, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorePutTelemetryDuplicates(t *testing.T) {
+	const ts = "2025-01-06T12:00:00Z"
+	reading := func(msgID string, seq int64, heartRate int) TelemetryRecord {
+		return TelemetryRecord{
+			TenantID:  "acme-clinic",
+			DeviceID:  "patient-001",
+			Timestamp: ts,
+			HeartRate: heartRate,
+			SpO2:      98,
+			MessageID: msgID,
+			Seq:       seq,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		first  TelemetryRecord
+		second TelemetryRecord
+		dup    bool
+	}{
+		{name: "redelivered message ID", first: reading("m-1", 0, 72), second: reading("m-1", 0, 72), dup: true},
+		{name: "message ID wins over changed values", first: reading("m-1", 0, 72), second: reading("m-1", 0, 75), dup: true},
+		{name: "different message IDs", first: reading("m-1", 0, 72), second: reading("m-2", 0, 72)},
+		{name: "redelivered sequence number", first: reading("", 41, 72), second: reading("", 41, 72), dup: true},
+		{name: "different sequence numbers", first: reading("", 41, 72), second: reading("", 42, 72)},
+		{name: "identical reading without IDs", first: reading("", 0, 72), second: reading("", 0, 72), dup: true},
+		{name: "different readings without IDs", first: reading("", 0, 72), second: reading("", 0, 73)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStore()
+			if err := store.PutTelemetry(ctx, tt.first); err != nil {
+				t.Fatalf("first PutTelemetry: %v", err)
+			}
+
+			err := store.PutTelemetry(ctx, tt.second)
+			if tt.dup && !errors.Is(err, ErrDuplicateReading) {
+				t.Fatalf("second PutTelemetry error = %v, want %v", err, ErrDuplicateReading)
+			}
+			if !tt.dup && err != nil {
+				t.Fatalf("second PutTelemetry: %v", err)
+			}
+
+			// A duplicate must not overwrite the stored reading, and
+			// same-second readings must both be kept
+			from, _ := time.Parse(time.RFC3339, ts)
+			page, err := store.QueryTelemetry(ctx, "acme-clinic", "patient-001", QueryOptions{From: from, To: from, Ascending: true})
+			if err != nil {
+				t.Fatalf("QueryTelemetry: %v", err)
+			}
+			want := 2
+			if tt.dup {
+				want = 1
+			}
+			if len(page.Records) != want {
+				t.Fatalf("%d readings stored, want %d", len(page.Records), want)
+			}
+			if tt.dup && page.Records[0].HeartRate != tt.first.HeartRate {
+				t.Errorf("stored heart rate %d, want the first delivery's %d", page.Records[0].HeartRate, tt.first.HeartRate)
+			}
+		})
+	}
+}
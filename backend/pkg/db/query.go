@@ -0,0 +1,106 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+// or belongs to a different device
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// QueryOptions controls a time-range query over a device's telemetry
+type QueryOptions struct {
+	From      time.Time
+	To        time.Time
+	Limit     int32
+	Ascending bool
+	Cursor    string // Opaque cursor from a previous QueryResult
+}
+
+// QueryResult is a single page of telemetry records
+type QueryResult struct {
+	Records    []TelemetryRecord
+	NextCursor string // Empty when there are no more pages
+}
+
+// cursorKey is the table key a paginated query resumes from
+type cursorKey struct {
+	PK string `json:"pk" dynamodbav:"PK"`
+	SK string `json:"sk" dynamodbav:"SK"`
+}
+
+func encodeCursor(key cursorKey) (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor, pk string) (cursorKey, error) {
+	var key cursorKey
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return key, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return key, ErrInvalidCursor
+	}
+
+	// A cursor is only valid for the partition it was issued for
+	if key.PK != pk || key.SK == "" {
+		return key, ErrInvalidCursor
+	}
+
+	return key, nil
+}
+
+func telemetryPK(tenantID, deviceID string) string {
+	return fmt.Sprintf("TENANT#%s#DEVICE#%s", tenantID, deviceID)
+}
+
+func telemetrySK(t time.Time) string {
+	return fmt.Sprintf("TS#%s", t.UTC().Format(time.RFC3339))
+}
+
+// sortKeyRange returns sort key bounds covering every item between from and
+// to, including the suffixed keys of items within the final second
+func sortKeyRange(from, to time.Time) (string, string) {
+	return telemetrySK(from), telemetrySK(to) + "~"
+}
+
+// recordSK is the sort key a reading is stored under:
+// TS#timestamp#message_key
+func recordSK(record TelemetryRecord) string {
+	return fmt.Sprintf("TS#%s#%s", record.Timestamp, MessageKey(record))
+}
+
+// HasMessageID reports whether a reading carries a device-assigned message
+// ID or sequence number, so that its redeliveries can be told apart from new
+// readings
+func HasMessageID(record TelemetryRecord) bool {
+	return record.MessageID != "" || record.Seq > 0
+}
+
+// MessageKey tells apart readings from one device with the same timestamp.
+// It is the device's message ID if set, else its sequence number, else a hash
+// of the reading so that only an exact redelivery has the same key.
+func MessageKey(record TelemetryRecord) string {
+	if record.MessageID != "" {
+		return "MSG#" + record.MessageID
+	}
+	if record.Seq > 0 {
+		return fmt.Sprintf("SEQ#%020d", record.Seq)
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%g|%d|%d|%d|%s",
+		record.HeartRate, record.TempC, record.SpO2, record.Steps, record.BatteryPct, record.FWVersion)
+	return fmt.Sprintf("H#%016x", h.Sum64())
+}
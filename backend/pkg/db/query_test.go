@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryTelemetryPagination(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	at := func(i int) string { return base.Add(time.Duration(i) * 2 * time.Second).Format(time.RFC3339) }
+
+	store := NewMemoryStore()
+	for i := 0; i < 7; i++ {
+		record := TelemetryRecord{TenantID: "acme-clinic", DeviceID: "patient-001", Timestamp: at(i), HeartRate: 70 + i}
+		if err := store.PutTelemetry(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := TelemetryRecord{TenantID: "acme-clinic", DeviceID: "patient-002", Timestamp: at(3)}
+	if err := store.PutTelemetry(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		from, to  int
+		limit     int32
+		ascending bool
+		want      [][]int // Reading indexes on each page
+	}{
+		{name: "one page", from: 0, to: 6, ascending: true, want: [][]int{{0, 1, 2, 3, 4, 5, 6}}},
+		{name: "ascending pages", from: 0, to: 6, limit: 3, ascending: true, want: [][]int{{0, 1, 2}, {3, 4, 5}, {6}}},
+		{name: "descending pages", from: 0, to: 6, limit: 3, want: [][]int{{6, 5, 4}, {3, 2, 1}, {0}}},
+		{name: "exact multiple of the limit", from: 1, to: 4, limit: 2, ascending: true, want: [][]int{{1, 2}, {3, 4}}},
+		{name: "range bounds inclusive", from: 2, to: 4, limit: 1, want: [][]int{{4}, {3}, {2}}},
+		{name: "empty range", from: 10, to: 12, limit: 3, ascending: true, want: [][]int{{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := QueryOptions{
+				From:      base.Add(time.Duration(tt.from) * 2 * time.Second),
+				To:        base.Add(time.Duration(tt.to) * 2 * time.Second),
+				Limit:     tt.limit,
+				Ascending: tt.ascending,
+			}
+
+			var got [][]int
+			for page := 0; ; page++ {
+				if page > len(tt.want) {
+					t.Fatalf("more than %d pages", len(tt.want))
+				}
+
+				result, err := store.QueryTelemetry(ctx, "acme-clinic", "patient-001", opts)
+				if err != nil {
+					t.Fatalf("QueryTelemetry: %v", err)
+				}
+
+				indexes := make([]int, 0, len(result.Records))
+				for _, record := range result.Records {
+					indexes = append(indexes, record.HeartRate-70)
+				}
+				got = append(got, indexes)
+
+				if result.NextCursor == "" {
+					break
+				}
+				opts.Cursor = result.NextCursor
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryTelemetryInvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	for i := 0; i < 3; i++ {
+		record := TelemetryRecord{TenantID: "acme-clinic", DeviceID: "patient-002", Timestamp: base.Add(time.Duration(i) * time.Second).Format(time.RFC3339)}
+		if err := store.PutTelemetry(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A valid cursor, but issued for another device
+	page, err := store.QueryTelemetry(ctx, "acme-clinic", "patient-002", QueryOptions{From: base, To: base.Add(time.Minute), Limit: 1, Ascending: true})
+	if err != nil {
+		t.Fatalf("QueryTelemetry: %v", err)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("no cursor for a partial page")
+	}
+	emptySK, err := encodeCursor(cursorKey{PK: telemetryPK("acme-clinic", "patient-001")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "not JSON", cursor: "bm90IGpzb24"},
+		{name: "other device", cursor: page.NextCursor},
+		{name: "missing sort key", cursor: emptySK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.QueryTelemetry(ctx, "acme-clinic", "patient-001", QueryOptions{From: base, To: base.Add(time.Minute), Cursor: tt.cursor})
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("QueryTelemetry error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestMessageKey(t *testing.T) {
+	reading := TelemetryRecord{TenantID: "acme-clinic", DeviceID: "patient-001", Timestamp: "2025-01-06T12:00:00Z", HeartRate: 72, TempC: 36.8, SpO2: 98}
+	with := func(change func(*TelemetryRecord)) TelemetryRecord {
+		r := reading
+		change(&r)
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		record TelemetryRecord
+		want   string
+	}{
+		{name: "message ID", record: with(func(r *TelemetryRecord) { r.MessageID = "m-1"; r.Seq = 7 }), want: "MSG#m-1"},
+		{name: "sequence number", record: with(func(r *TelemetryRecord) { r.Seq = 7 }), want: "SEQ#00000000000000000007"},
+		{name: "content hash", record: reading, want: MessageKey(with(func(r *TelemetryRecord) { r.AnomalyFlag = true }))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MessageKey(tt.record); got != tt.want {
+				t.Errorf("key %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Sequence keys sort in sequence order, so same-second readings keep it
+	if a, b := MessageKey(with(func(r *TelemetryRecord) { r.Seq = 9 })), MessageKey(with(func(r *TelemetryRecord) { r.Seq = 10 })); a >= b {
+		t.Errorf("key %q for seq 9 sorts after %q for seq 10", a, b)
+	}
+
+	// Any change to a reported value gives a different hash
+	if MessageKey(reading) == MessageKey(with(func(r *TelemetryRecord) { r.TempC = 36.9 })) {
+		t.Error("readings with different temperatures share a key")
+	}
+
+	if got, want := recordSK(reading), "TS#2025-01-06T12:00:00Z#"+MessageKey(reading); got != want {
+		t.Errorf("sort key %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// DefaultRetentionDays applies to tenants without a retention policy
+	DefaultRetentionDays = 30
+	// MaxRetentionDays is the longest retention a policy may set (10 years)
+	MaxRetentionDays = 3650
+
+	// retentionCacheTTL bounds how long a writer keeps using a policy after
+	// another process changes it
+	retentionCacheTTL = time.Minute
+)
+
+// RetentionPolicy sets how long a tenant's data is kept. Readings flagged as
+// anomalies, and anomaly events, use AnomalyDays; everything else NormalDays.
+type RetentionPolicy struct {
+	TenantID    string `dynamodbav:"tenant_id"`
+	NormalDays  int    `dynamodbav:"normal_days"`
+	AnomalyDays int    `dynamodbav:"anomaly_days"`
+	UpdatedAt   string `dynamodbav:"updated_at,omitempty"` // Empty for the default policy
+}
+
+// DefaultRetentionPolicy returns the policy used for tenants without one
+func DefaultRetentionPolicy(tenantID string) RetentionPolicy {
+	return RetentionPolicy{
+		TenantID:    tenantID,
+		NormalDays:  DefaultRetentionDays,
+		AnomalyDays: DefaultRetentionDays,
+	}
+}
+
+// Validate checks both retention periods are within range
+func (p RetentionPolicy) Validate() error {
+	if p.NormalDays < 1 || p.NormalDays > MaxRetentionDays {
+		return fmt.Errorf("normal_days must be between 1 and %d", MaxRetentionDays)
+	}
+	if p.AnomalyDays < 1 || p.AnomalyDays > MaxRetentionDays {
+		return fmt.Errorf("anomaly_days must be between 1 and %d", MaxRetentionDays)
+	}
+	return nil
+}
+
+// ExpiresAt returns when data from a reading taken at the given time should
+// be deleted
+func (p RetentionPolicy) ExpiresAt(at time.Time, anomaly bool) time.Time {
+	days := p.NormalDays
+	if anomaly {
+		days = p.AnomalyDays
+	}
+	return at.Add(time.Duration(days) * 24 * time.Hour)
+}
+
+// Tenant config items share the telemetry table:
+// Partition Key: TENANT#tenant_id
+// Sort Key: CONFIG#retention
+const retentionSK = "CONFIG#retention"
+
+// GetRetentionPolicy returns a tenant's retention policy, or the default
+// policy if none has been set
+func (d *DynamoDBClient) GetRetentionPolicy(ctx context.Context, tenantID string) (*RetentionPolicy, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: devicePK(tenantID)},
+			"SK": &types.AttributeValueMemberS{Value: retentionSK},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		policy := DefaultRetentionPolicy(tenantID)
+		return &policy, nil
+	}
+
+	var policy RetentionPolicy
+	if err := attributevalue.UnmarshalMap(result.Item, &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal retention policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// PutRetentionPolicy sets a tenant's retention policy. It applies to data
+// written from then on; existing items keep the expiry they were written with.
+func (d *DynamoDBClient) PutRetentionPolicy(ctx context.Context, policy RetentionPolicy) (*RetentionPolicy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal retention policy: %w", err)
+	}
+	item["PK"] = &types.AttributeValueMemberS{Value: devicePK(policy.TenantID)}
+	item["SK"] = &types.AttributeValueMemberS{Value: retentionSK}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to put retention policy: %w", err)
+	}
+
+	d.retention.set(policy)
+
+	return &policy, nil
+}
+
+// expiresAt returns the TTL attribute value for data from a reading with the
+// given timestamp, so a late or replayed reading is not kept any longer than
+// one written on time. A timestamp that does not parse counts from now.
+func (d *DynamoDBClient) expiresAt(ctx context.Context, tenantID, timestamp string, anomaly bool) (int64, error) {
+	policy, err := d.retention.get(ctx, tenantID, d.GetRetentionPolicy)
+	if err != nil {
+		return 0, err
+	}
+	at, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+	return policy.ExpiresAt(at, anomaly).Unix(), nil
+}
+
+// retentionCache keeps recently read policies so every write does not cost a
+// GetItem
+type retentionCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedPolicy
+}
+
+type cachedPolicy struct {
+	policy  RetentionPolicy
+	fetched time.Time
+}
+
+func newRetentionCache() *retentionCache {
+	return &retentionCache{entries: make(map[string]cachedPolicy)}
+}
+
+// get returns the cached policy, loading it when missing or expired. If the
+// load fails, an expired entry is used rather than failing the write.
+func (c *retentionCache) get(ctx context.Context, tenantID string, load func(context.Context, string) (*RetentionPolicy, error)) (RetentionPolicy, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[tenantID]
+	c.mu.Unlock()
+
+	if ok && time.Since(entry.fetched) < retentionCacheTTL {
+		return entry.policy, nil
+	}
+
+	policy, err := load(ctx, tenantID)
+	if err != nil {
+		if ok {
+			log.Printf("Using cached retention policy for %s: %v", tenantID, err)
+			return entry.policy, nil
+		}
+		return RetentionPolicy{}, err
+	}
+
+	c.set(*policy)
+	return *policy, nil
+}
+
+func (c *retentionCache) set(policy RetentionPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[policy.TenantID] = cachedPolicy{policy: policy, fetched: time.Now()}
+}
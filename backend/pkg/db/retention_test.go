@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExpiresAt(t *testing.T) {
+	policy := RetentionPolicy{TenantID: "acme-clinic", NormalDays: 7, AnomalyDays: 90}
+	client := &DynamoDBClient{retention: newRetentionCache()}
+	client.retention.set(policy)
+
+	taken := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		timestamp string
+		anomaly   bool
+		want      time.Time
+	}{
+		{name: "normal reading", timestamp: "2025-01-06T12:00:00Z", want: taken.AddDate(0, 0, 7)},
+		{name: "anomaly", timestamp: "2025-01-06T12:00:00Z", anomaly: true, want: taken.AddDate(0, 0, 90)},
+		{name: "late reading counts from when it was taken", timestamp: "2024-12-01T00:00:00Z", want: time.Date(2024, 12, 8, 0, 0, 0, 0, time.UTC)},
+		{name: "offset timestamp", timestamp: "2025-01-06T13:00:00+01:00", want: taken.AddDate(0, 0, 7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.expiresAt(context.Background(), "acme-clinic", tt.timestamp, tt.anomaly)
+			if err != nil {
+				t.Fatalf("expiresAt: %v", err)
+			}
+			if got != tt.want.Unix() {
+				t.Errorf("expires %v, want %v", time.Unix(got, 0).UTC(), tt.want)
+			}
+		})
+	}
+
+	// A timestamp that does not parse counts from now
+	before := time.Now()
+	got, err := client.expiresAt(context.Background(), "acme-clinic", "not a time", false)
+	if err != nil {
+		t.Fatalf("expiresAt: %v", err)
+	}
+	if min := before.AddDate(0, 0, 7).Unix(); got < min || got > min+5 {
+		t.Errorf("expires %v for an invalid timestamp, want about 7 days from now", time.Unix(got, 0).UTC())
+	}
+}
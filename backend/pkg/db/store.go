@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// TelemetryStore persists device readings and answers time-range queries
+type TelemetryStore interface {
+	PutTelemetry(ctx context.Context, record TelemetryRecord) error
+	GetLatestTelemetry(ctx context.Context, tenantID, deviceID string) (*TelemetryRecord, error)
+	QueryTelemetry(ctx context.Context, tenantID, deviceID string, opts QueryOptions) (*QueryResult, error)
+	AggregateTelemetry(ctx context.Context, tenantID, deviceID string, from, to time.Time, width time.Duration) ([]TelemetryBucket, error)
+}
+
+// DeviceRegistry manages registered devices and their metadata
+type DeviceRegistry interface {
+	CreateDevice(ctx context.Context, device Device) (*Device, error)
+	GetDevice(ctx context.Context, tenantID, deviceID string) (*Device, error)
+	ListDevices(ctx context.Context, tenantID string) ([]Device, error)
+	UpdateDevice(ctx context.Context, device Device) (*Device, error)
+	DeleteDevice(ctx context.Context, tenantID, deviceID string) error
+}
+
+// AnomalyStore keeps a per-tenant history of detected anomalies
+type AnomalyStore interface {
+	PutAnomaly(ctx context.Context, event AnomalyEvent) error
+	QueryAnomalies(ctx context.Context, tenantID string, q AnomalyQuery) (*AnomalyPage, error)
+}
+
+// TenantConfigStore holds per-tenant settings such as data retention
+type TenantConfigStore interface {
+	GetRetentionPolicy(ctx context.Context, tenantID string) (*RetentionPolicy, error)
+	PutRetentionPolicy(ctx context.Context, policy RetentionPolicy) (*RetentionPolicy, error)
+}
+
+// Store is the storage backend used by the API and the consumer
+type Store interface {
+	TelemetryStore
+	DeviceRegistry
+	AnomalyStore
+	TenantConfigStore
+}
+
+var (
+	_ Store = (*DynamoDBClient)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,156 @@
+package dlq
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Stages at which a message can be dead-lettered
+const (
+	StageDecode   = "decode"
+	StageValidate = "validate"
+	StagePersist  = "persist"
+)
+
+// Entry is a message that could not be processed, kept so it can be
+// inspected and replayed
+type Entry struct {
+	Time     string `json:"time"`     // When the entry was written (RFC3339)
+	Topic    string `json:"topic"`    // Topic the message arrived on
+	Payload  []byte `json:"payload"`  // Original message bytes (base64 in JSON)
+	Stage    string `json:"stage"`    // StageDecode, StageValidate or StagePersist
+	Error    string `json:"error"`    // Last error
+	Attempts int    `json:"attempts"` // Processing attempts so far, including replays
+}
+
+// Sink receives dead-lettered messages
+type Sink interface {
+	Write(entry Entry) error
+	Close() error
+}
+
+var (
+	_ Sink = (*FileSink)(nil)
+	_ Sink = (*MQTTSink)(nil)
+)
+
+// FileSink appends entries to an NDJSON file, one entry per line
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (or creates) the file for appending
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DLQ file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write appends an entry and syncs it to disk
+func (s *FileSink) Write(entry Entry) error {
+	line, err := encode(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write DLQ entry: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync DLQ file: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// MQTTSink publishes entries as JSON to a dedicated topic at QoS 1
+type MQTTSink struct {
+	client mqtt.Client
+	topic  string
+}
+
+// NewMQTTSink publishes through an already connected client
+func NewMQTTSink(client mqtt.Client, topic string) *MQTTSink {
+	return &MQTTSink{client: client, topic: topic}
+}
+
+// Write publishes an entry and waits for the broker to acknowledge it
+func (s *MQTTSink) Write(entry Entry) error {
+	line, err := encode(entry)
+	if err != nil {
+		return err
+	}
+
+	token := s.client.Publish(s.topic, 1, false, line)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timed out publishing DLQ entry to %s", s.topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish DLQ entry: %w", err)
+	}
+
+	return nil
+}
+
+// Close is a no-op; the client belongs to the caller
+func (s *MQTTSink) Close() error {
+	return nil
+}
+
+func encode(entry Entry) ([]byte, error) {
+	if entry.Time == "" {
+		entry.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode DLQ entry: %w", err)
+	}
+
+	return append(line, '\n'), nil
+}
+
+// ReadEntries decodes NDJSON entries, as written by FileSink or captured from
+// an MQTTSink topic. Blank lines are skipped.
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	entries := make([]Entry, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: invalid DLQ entry: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read DLQ entries: %w", err)
+	}
+
+	return entries, nil
+}
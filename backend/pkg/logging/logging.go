@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Log levels. Debug adds a line per reading to the usual output.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+)
+
+var debug atomic.Bool
+
+// ParseLevel checks that level is a known log level
+func ParseLevel(level string) error {
+	switch level {
+	case LevelDebug, LevelInfo:
+		return nil
+	}
+	return fmt.Errorf("unknown log level %q (expected %s or %s)", level, LevelDebug, LevelInfo)
+}
+
+// SetLevel changes the log level, which may be done at any time
+func SetLevel(level string) error {
+	if err := ParseLevel(level); err != nil {
+		return err
+	}
+	debug.Store(level == LevelDebug)
+	return nil
+}
+
+// Level returns the current log level
+func Level() string {
+	if debug.Load() {
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+// Debugf logs like log.Printf when the level is debug
+func Debugf(format string, args ...interface{}) {
+	if debug.Load() {
+		log.Printf(format, args...)
+	}
+}
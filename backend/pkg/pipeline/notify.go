@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+// Notifier alerts on-call staff about an anomaly
+type Notifier interface {
+	Notify(ctx context.Context, t schema.Telemetry, result anomaly.AnomalyResult) error
+}
+
+// SNSNotifier publishes alerts to an SNS topic
+type SNSNotifier struct {
+	client   *sns.Client
+	topicARN string
+}
+
+// NewSNSNotifier creates a notifier that publishes to topicARN
+func NewSNSNotifier(client *sns.Client, topicARN string) *SNSNotifier {
+	return &SNSNotifier{client: client, topicARN: topicARN}
+}
+
+// Notify publishes an alert for an anomalous reading, listing every finding
+func (n *SNSNotifier) Notify(ctx context.Context, t schema.Telemetry, result anomaly.AnomalyResult) error {
+	var findings strings.Builder
+	for _, f := range result.Findings {
+		fmt.Fprintf(&findings, "- [%s] %s: %s\n", strings.ToUpper(string(f.Severity)), f.Type, f.Reason)
+	}
+
+	message := fmt.Sprintf(`🚨 HEALTH ALERT 🚨
+
+Device: %s
+Tenant: %s
+Timestamp: %s
+
+Severity: %s
+Findings:
+%s
+Vitals:
+- Heart Rate: %d bpm
+- Temperature: %.1f°C
+- SpO2: %d%%
+- Steps: %d
+- Battery: %d%%
+
+%s`,
+		t.DeviceID,
+		t.TenantID,
+		t.Timestamp,
+		strings.ToUpper(string(result.Severity)),
+		findings.String(),
+		t.Metrics.HeartRate,
+		t.Metrics.TempC,
+		t.Metrics.SpO2,
+		t.Metrics.Steps,
+		t.BatteryPct,
+		action(result.Severity),
+	)
+
+	_, err := n.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(n.topicARN),
+		Subject:  aws.String(alertSubject(t, result)),
+		Message:  aws.String(message),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish alert: %w", err)
+	}
+	return nil
+}
+
+// maxSubjectLength is the longest subject SNS accepts
+const maxSubjectLength = 100
+
+// alertSubject names the most severe finding, and how many others the
+// message lists, within SNS's subject limit
+func alertSubject(t schema.Telemetry, result anomaly.AnomalyResult) string {
+	typ := result.AnomalyType
+	if len(result.Findings) > 0 {
+		typ = result.Findings[0].Type
+		if more := len(result.Findings) - 1; more > 0 {
+			typ += fmt.Sprintf(" (+%d more)", more)
+		}
+	}
+
+	subject := fmt.Sprintf("[HealthSense] %s %s Alert - %s",
+		strings.ToUpper(string(result.Severity)), typ, t.DeviceID)
+	if len(subject) <= maxSubjectLength {
+		return subject
+	}
+	// Cut on a character boundary
+	cut := maxSubjectLength
+	for cut > 0 && !utf8.RuneStart(subject[cut]) {
+		cut--
+	}
+	return subject[:cut]
+}
+
+// action tells staff how urgently to respond to an alert
+func action(severity anomaly.Severity) string {
+	switch severity {
+	case anomaly.SeverityCritical:
+		return "Action Required: Please check patient immediately."
+	case anomaly.SeverityWarning:
+		return "Action Required: Please review the patient soon."
+	default:
+		return "For information only: no action required."
+	}
+}
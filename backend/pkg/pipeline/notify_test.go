@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+func TestAlertSubject(t *testing.T) {
+	finding := func(typ string, severity anomaly.Severity) anomaly.Finding {
+		return anomaly.Finding{Type: typ, Severity: severity}
+	}
+
+	tests := []struct {
+		name     string
+		deviceID string
+		findings []anomaly.Finding
+		want     string
+	}{
+		{
+			name:     "one finding",
+			deviceID: "patient-001",
+			findings: []anomaly.Finding{finding(anomaly.RuleTachycardia, anomaly.SeverityWarning)},
+			want:     "[HealthSense] WARNING tachycardia Alert - patient-001",
+		},
+		{
+			name:     "most severe finding named",
+			deviceID: "patient-001",
+			findings: []anomaly.Finding{
+				finding(anomaly.RuleTachycardia, anomaly.SeverityWarning),
+				finding(anomaly.RuleHypoxia, anomaly.SeverityCritical),
+				finding(anomaly.RuleEarlyWarning, anomaly.SeverityCritical),
+				finding(anomaly.TypeHeartRateDeviation, anomaly.SeverityInfo),
+			},
+			want: "[HealthSense] CRITICAL hypoxia (+3 more) Alert - patient-001",
+		},
+		{
+			name:     "long device ID cut to the limit",
+			deviceID: strings.Repeat("d", 120),
+			findings: []anomaly.Finding{finding(anomaly.RuleFever, anomaly.SeverityWarning)},
+			want:     ("[HealthSense] WARNING fever Alert - " + strings.Repeat("d", 120))[:maxSubjectLength],
+		},
+		{
+			name:     "cut on a character boundary",
+			deviceID: strings.Repeat("d", 63) + "é",
+			findings: []anomaly.Finding{finding(anomaly.RuleFever, anomaly.SeverityWarning)},
+			want:     "[HealthSense] WARNING fever Alert - " + strings.Repeat("d", 63),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := alertSubject(schema.Telemetry{DeviceID: tt.deviceID}, anomaly.NewResult(tt.findings))
+			if got != tt.want {
+				t.Errorf("subject %q, want %q", got, tt.want)
+			}
+			if len(got) > maxSubjectLength {
+				t.Errorf("subject is %d bytes, over the %d limit", len(got), maxSubjectLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+// Stage names, in the order stages must run
+const (
+	StageDecode   = "decode"
+	StageValidate = "validate"
+	StageEnrich   = "enrich"
+	StageDetect   = "detect"
+	StagePersist  = "persist"
+	StageCache    = "cache"
+	StageNotify   = "notify"
+	StagePublish  = "publish"
+)
+
+var stageOrder = []string{
+	StageDecode, StageValidate, StageEnrich, StageDetect,
+	StagePersist, StageCache, StageNotify, StagePublish,
+}
+
+// Message is one reading as it moves through the pipeline. The source fills
+// in the first block; stages fill in the rest.
+type Message struct {
+	Topic    string // Topic the reading arrived on; empty if the source has none
+	Payload  []byte
+	Attempts int  // Attempts already made, for messages replayed from the DLQ
+	Replay   bool // Replayed messages are stored but not cached, notified or published
+
+	Telemetry  schema.Telemetry
+	Validation schema.Validation
+	Score      *anomaly.EarlyWarningScore // Nil if the vitals were not scored
+	Anomaly    anomaly.AnomalyResult      // Findings to report for this reading
+	Open       []string                   // Conditions open for the device, which flag the reading
+	Events     []db.AnomalyEvent          // One per reported finding
+	Record     db.TelemetryRecord
+	Stored     bool // Written, or queued for a batch write
+}
+
+// Stage is one step of the pipeline. An error stops the message there.
+type Stage interface {
+	Name() string
+	Process(ctx context.Context, msg *Message) error
+}
+
+// StageError is returned by Process when a stage stops a message
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// FailedAt reports whether err stopped a message at the named stage
+func FailedAt(err error, stage string) bool {
+	var stageErr *StageError
+	return errors.As(err, &stageErr) && stageErr.Stage == stage
+}
+
+// Pipeline runs a message through its stages in order
+type Pipeline struct {
+	stages []Stage
+	stale  *StaleMonitor
+}
+
+// New creates a pipeline from stages, which run in the order given
+func New(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Process runs msg through every stage, stopping at the first error, which
+// is returned as a *StageError
+func (p *Pipeline) Process(ctx context.Context, msg *Message) error {
+	for _, stage := range p.stages {
+		if err := stage.Process(ctx, msg); err != nil {
+			return &StageError{Stage: stage.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// StaleMonitor returns the monitor fed by a built pipeline's detect stage,
+// or nil. It only reports stale devices while its Run is going.
+func (p *Pipeline) StaleMonitor() *StaleMonitor {
+	return p.stale
+}
+
+// Stages returns the names of the pipeline's stages
+func (p *Pipeline) Stages() []string {
+	names := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		names[i] = stage.Name()
+	}
+	return names
+}
+
+// Deps are what the built-in stages are built from. Only the dependencies of
+// the stages being built are needed.
+type Deps struct {
+	Registry db.DeviceRegistry          // enrich
+	Detector *anomaly.SimpleDetector    // detect
+	Baseline *anomaly.BaselineDetector  // detect, optional
+	Sustain  *anomaly.SustainedDetector // detect, optional
+	Scorer   *anomaly.Scorer            // detect, optional
+	Store    db.Store                   // persist
+	Cache    cache.LatestCache          // cache
+	Notifier Notifier                   // notify
+	Bus      pubsub.Bus                 // publish
+
+	Persist PersistOptions
+	Timeout time.Duration    // Limit for each call to a dependency (default 5s)
+	Now     func() time.Time // Clock for validation (default time.Now)
+}
+
+// ParseStages splits a comma-separated list of stage names
+func ParseStages(list string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Build assembles a pipeline from stage names. Stages may be left out, but
+// decode is required, validate is required by every stage after it, and the
+// rest must keep their standard order.
+func Build(names []string, deps Deps) (*Pipeline, error) {
+	if len(names) == 0 || names[0] != StageDecode {
+		return nil, fmt.Errorf("pipeline must start with %s", StageDecode)
+	}
+	if len(names) > 1 && indexOf(names, StageValidate) < 0 {
+		return nil, fmt.Errorf("stages after %s need %s, which normalises and checks each reading's timestamp", StageDecode, StageValidate)
+	}
+	if deps.Timeout <= 0 {
+		deps.Timeout = 5 * time.Second
+	}
+	if deps.Now == nil {
+		deps.Now = time.Now
+	}
+
+	var stale *StaleMonitor
+	if indexOf(names, StageDetect) >= 0 && deps.Detector != nil {
+		stale = newStaleMonitor(names, deps)
+	}
+
+	stages := make([]Stage, 0, len(names))
+	next := 0
+	for _, name := range names {
+		pos := indexOf(stageOrder, name)
+		if pos < 0 {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+		if pos < next {
+			return nil, fmt.Errorf("stage %q is repeated or out of order (expected order: %s)", name, strings.Join(stageOrder, ", "))
+		}
+		next = pos + 1
+
+		stage, err := buildStage(name, deps, stale)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+
+	p := New(stages...)
+	p.stale = stale
+	return p, nil
+}
+
+func buildStage(name string, deps Deps, stale *StaleMonitor) (Stage, error) {
+	missing := func(dep string) error {
+		return fmt.Errorf("stage %q needs %s", name, dep)
+	}
+
+	switch name {
+	case StageDecode:
+		return Decode(), nil
+	case StageValidate:
+		return Validate(deps.Now), nil
+	case StageEnrich:
+		if deps.Registry == nil {
+			return nil, missing("a device registry")
+		}
+		return Enrich(deps.Registry, deps.Timeout), nil
+	case StageDetect:
+		if deps.Detector == nil {
+			return nil, missing("a detector")
+		}
+		return Detect(deps.Detector, deps.Timeout, DetectOptions{
+			Baseline: deps.Baseline,
+			Sustain:  deps.Sustain,
+			Scorer:   deps.Scorer,
+			Stale:    stale,
+		}), nil
+	case StagePersist:
+		if deps.Store == nil {
+			return nil, missing("a store")
+		}
+		return Persist(deps.Store, deps.Timeout, deps.Persist), nil
+	case StageCache:
+		if deps.Cache == nil {
+			return nil, missing("a cache")
+		}
+		return Cache(deps.Cache, deps.Timeout), nil
+	case StageNotify:
+		if deps.Notifier == nil {
+			return nil, missing("a notifier")
+		}
+		return Notify(deps.Notifier, deps.Detector, deps.Timeout), nil
+	case StagePublish:
+		if deps.Bus == nil {
+			return nil, missing("a pub/sub bus")
+		}
+		return Publish(deps.Bus, deps.Timeout), nil
+	}
+	return nil, fmt.Errorf("unknown stage %q", name)
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+func TestBuild(t *testing.T) {
+	deps := Deps{
+		Detector: anomaly.NewSimpleDetector(),
+		Store:    db.NewMemoryStore(),
+		Cache:    cache.NewMemoryCache(),
+	}
+
+	tests := []struct {
+		name    string
+		stages  string
+		wantErr string // Part of the error; empty if the build succeeds
+	}{
+		{name: "decode only", stages: "decode"},
+		{name: "decode and validate", stages: "decode,validate"},
+		{name: "standard stages", stages: "decode,validate,detect,persist,cache"},
+		{name: "empty", stages: "", wantErr: "must start with decode"},
+		{name: "decode not first", stages: "validate,decode", wantErr: "must start with decode"},
+		{name: "detect without validate", stages: "decode,detect", wantErr: "need validate"},
+		{name: "persist without validate", stages: "decode,persist", wantErr: "need validate"},
+		{name: "cache without validate", stages: "decode,detect,persist,cache", wantErr: "need validate"},
+		{name: "out of order", stages: "decode,validate,persist,detect", wantErr: "out of order"},
+		{name: "repeated", stages: "decode,validate,validate", wantErr: "repeated"},
+		{name: "unknown", stages: "decode,validate,archive", wantErr: `unknown stage "archive"`},
+		{name: "missing dependency", stages: "decode,validate,enrich", wantErr: "needs a device registry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Build(ParseStages(tt.stages), deps)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Build: %v", err)
+				}
+				if got := strings.Join(p.Stages(), ","); got != tt.stages {
+					t.Errorf("stages %q, want %q", got, tt.stages)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Build error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
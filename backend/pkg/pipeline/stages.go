@@ -0,0 +1,461 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/logging"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+// stageFunc adapts a function to the Stage interface
+type stageFunc struct {
+	name    string
+	process func(ctx context.Context, msg *Message) error
+}
+
+func (s stageFunc) Name() string {
+	return s.name
+}
+
+func (s stageFunc) Process(ctx context.Context, msg *Message) error {
+	return s.process(ctx, msg)
+}
+
+// Decode parses the payload as a telemetry reading
+func Decode() Stage {
+	return stageFunc{name: StageDecode, process: func(ctx context.Context, msg *Message) error {
+		if err := json.Unmarshal(msg.Payload, &msg.Telemetry); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		logging.Debugf("[%s] HR:%d Temp:%.1f SpO2:%d",
+			msg.Telemetry.DeviceID,
+			msg.Telemetry.Metrics.HeartRate,
+			msg.Telemetry.Metrics.TempC,
+			msg.Telemetry.Metrics.SpO2,
+		)
+		return nil
+	}}
+}
+
+// Validate rejects malformed readings and flags implausible ones. The
+// timestamp is normalised to UTC RFC3339, so keys and range queries line up
+// whatever offset the device reported in.
+func Validate(now func() time.Time) Stage {
+	return stageFunc{name: StageValidate, process: func(ctx context.Context, msg *Message) error {
+		validation, err := schema.Validate(msg.Telemetry, msg.Topic, now())
+		if err != nil {
+			return err
+		}
+
+		msg.Validation = validation
+		msg.Telemetry.Timestamp = validation.Time.Format(time.RFC3339)
+
+		if len(validation.Flags) > 0 {
+			log.Printf("[%s] Reading %s flagged: %v", msg.Telemetry.DeviceID, msg.Telemetry.Timestamp, validation.Flags)
+		}
+		return nil
+	}}
+}
+
+// Enrich adds devices to the registry the first time they report. Failures
+// are logged and retried on the device's next reading.
+func Enrich(registry db.DeviceRegistry, timeout time.Duration) Stage {
+	var known sync.Map // tenant_id/device_id -> struct{}
+
+	return stageFunc{name: StageEnrich, process: func(ctx context.Context, msg *Message) error {
+		t := msg.Telemetry
+		key := t.TenantID + "/" + t.DeviceID
+		if _, ok := known.Load(key); ok {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		_, err := registry.CreateDevice(ctx, db.Device{
+			TenantID:  t.TenantID,
+			DeviceID:  t.DeviceID,
+			FWVersion: t.FWVersion,
+			Status:    db.DeviceStatusActive,
+		})
+		if err == nil {
+			log.Printf("[%s] Registered new device for tenant %s", t.DeviceID, t.TenantID)
+		} else if !errors.Is(err, db.ErrDeviceExists) {
+			log.Printf("Failed to register device %s: %v", t.DeviceID, err)
+			return nil
+		}
+
+		known.Store(key, struct{}{})
+		return nil
+	}}
+}
+
+// DetectOptions add optional detectors to the detect stage
+type DetectOptions struct {
+	Baseline *anomaly.BaselineDetector  // Judges vitals against the device's baseline
+	Sustain  *anomaly.SustainedDetector // Reports conditions only once they last
+	Scorer   *anomaly.Scorer            // Computes the reading's early warning score
+	Stale    *StaleMonitor              // Told about every live reading
+}
+
+// Detect checks the reading against the detector's rules, and the optional
+// detectors. Implausible values point at the sensor rather than the patient,
+// so they are stored but not checked. Replayed readings are judged on their
+// own, since they are too old for the device's baseline or episodes.
+func Detect(detector *anomaly.SimpleDetector, timeout time.Duration, opts DetectOptions) Stage {
+	return stageFunc{name: StageDetect, process: func(ctx context.Context, msg *Message) error {
+		t := msg.Telemetry
+		isLive := live(ctx, msg)
+		if opts.Stale != nil && isLive {
+			opts.Stale.Seen(t)
+		}
+
+		reading := anomaly.Reading{
+			TenantID:    t.TenantID,
+			DeviceID:    t.DeviceID,
+			HeartRate:   t.Metrics.HeartRate,
+			TempC:       t.Metrics.TempC,
+			SpO2:        t.Metrics.SpO2,
+			BatteryPct:  t.BatteryPct,
+			SkipVitals:  !msg.Validation.VitalsTrusted(),
+			SkipBattery: msg.Validation.Flagged(schema.FlagBatteryRange),
+		}
+		msg.Anomaly = detector.Detect(reading)
+
+		if opts.Scorer != nil && !reading.SkipVitals {
+			score := opts.Scorer.Score(map[string]float64{
+				"hr_bpm":   float64(t.Metrics.HeartRate),
+				"temp_c":   t.Metrics.TempC,
+				"spo2_pct": float64(t.Metrics.SpO2),
+			})
+			msg.Score = &score
+			if findings := detector.CheckScore(t.TenantID, score); len(findings) > 0 {
+				msg.Anomaly = anomaly.NewResult(append(msg.Anomaly.Findings, findings...))
+			}
+		}
+
+		if opts.Baseline != nil && !reading.SkipVitals && isLive && detector.Enabled(t.TenantID, anomaly.RuleBaseline) {
+			baselineCtx, cancel := context.WithTimeout(ctx, timeout)
+			deviations, err := opts.Baseline.Check(baselineCtx, reading, msg.Validation.Time, msg.Anomaly)
+			cancel()
+			if err != nil {
+				log.Printf("[%s] Baseline check failed: %v", t.DeviceID, err)
+			}
+			if len(deviations) > 0 {
+				msg.Anomaly = anomaly.NewResult(append(msg.Anomaly.Findings, deviations...))
+			}
+		}
+
+		msg.Open = msg.Anomaly.Types()
+		if opts.Sustain != nil && isLive {
+			found := msg.Anomaly
+			sustainCtx, cancel := context.WithTimeout(ctx, timeout)
+			report, open, err := opts.Sustain.Apply(sustainCtx, reading, msg.Validation.Time, found)
+			cancel()
+			if err != nil {
+				log.Printf("[%s] Sustained detection failed: %v", t.DeviceID, err)
+			}
+			msg.Anomaly, msg.Open = report, open
+			if found.IsAnomaly && !report.IsAnomaly {
+				logging.Debugf("[%s] Not yet sustained: %s", t.DeviceID, found.AnomalyType)
+			}
+		}
+		if !msg.Anomaly.IsAnomaly {
+			return nil
+		}
+
+		log.Printf("[%s] ANOMALY DETECTED: %s - %s", t.DeviceID, msg.Anomaly.AnomalyType, msg.Anomaly.Reason)
+		msg.Events = anomalyEvents(t, msg.Anomaly)
+		return nil
+	}}
+}
+
+// anomalyEvents returns the event stored for each of a reading's findings
+func anomalyEvents(t schema.Telemetry, result anomaly.AnomalyResult) []db.AnomalyEvent {
+	events := make([]db.AnomalyEvent, 0, len(result.Findings))
+	for _, f := range result.Findings {
+		events = append(events, db.AnomalyEvent{
+			TenantID:    t.TenantID,
+			DeviceID:    t.DeviceID,
+			Timestamp:   t.Timestamp,
+			AnomalyType: f.Type,
+			Reason:      f.Reason,
+			Severity:    string(f.Severity),
+			Metric:      f.Metric,
+			Value:       f.Value,
+			Threshold:   f.Threshold,
+			HeartRate:   t.Metrics.HeartRate,
+			TempC:       t.Metrics.TempC,
+			SpO2:        t.Metrics.SpO2,
+		})
+	}
+	return events
+}
+
+// PersistOptions control how the persist stage writes readings
+type PersistOptions struct {
+	// Attempts is the number of tries for each write (default 1)
+	Attempts int
+
+	// Batch, if set, queues readings without a msg_id or seq for batched
+	// writes instead of writing them one at a time, with their anomaly
+	// events, which it writes once the reading is stored. Its own OnFailure
+	// reports failed batches. Batched writes cannot be conditional, so
+	// readings with an ID are still written one at a time, and a redelivery
+	// stops at persist however late it arrives.
+	Batch *db.BatchWriter
+
+	// OnFailure, if set, takes over a reading that could not be stored, and
+	// the message continues through the pipeline. Without it the error
+	// stops the message.
+	OnFailure func(msg *Message, attempts int, err error)
+}
+
+// Persist stores the reading, and an anomaly event for each finding. A
+// reading that is already stored stops the message with an error wrapping
+// db.ErrDuplicateReading.
+func Persist(store db.Store, timeout time.Duration, opts PersistOptions) Stage {
+	if opts.Attempts < 1 {
+		opts.Attempts = 1
+	}
+
+	return stageFunc{name: StagePersist, process: func(ctx context.Context, msg *Message) error {
+		t := msg.Telemetry
+		msg.Record = db.TelemetryRecord{
+			TenantID:     t.TenantID,
+			DeviceID:     t.DeviceID,
+			Timestamp:    t.Timestamp,
+			HeartRate:    t.Metrics.HeartRate,
+			TempC:        t.Metrics.TempC,
+			SpO2:         t.Metrics.SpO2,
+			Steps:        t.Metrics.Steps,
+			BatteryPct:   t.BatteryPct,
+			FWVersion:    t.FWVersion,
+			AnomalyFlag:  len(msg.Open) > 0,
+			AnomalyType:  strings.Join(msg.Open, ","),
+			MessageID:    t.MessageID,
+			Seq:          t.Seq,
+			QualityFlags: msg.Validation.Flags,
+		}
+		if msg.Score != nil {
+			msg.Record.EWSScore = &msg.Score.Total
+			msg.Record.EWSBand = string(msg.Score.Band)
+		}
+
+		var attempts int
+		var err error
+		batched := opts.Batch != nil && !db.HasMessageID(msg.Record)
+		if batched {
+			attempts, err = 1, opts.Batch.Add(ctx, msg.Record, msg.Events, msg.Attempts)
+		} else {
+			attempts, err = write(ctx, store, timeout, opts.Attempts, msg.Record)
+		}
+
+		if errors.Is(err, db.ErrDuplicateReading) {
+			// A redelivery; it was fully handled the first time
+			return fmt.Errorf("reading %s from %s already stored (%s): %w", t.Timestamp, t.DeviceID, db.MessageKey(msg.Record), err)
+		} else if err != nil {
+			if opts.OnFailure == nil {
+				return fmt.Errorf("failed to store telemetry after %d attempts: %w", attempts, err)
+			}
+			// Keep going so live views still see the reading; the anomaly
+			// events go along with it
+			log.Printf("Failed to store telemetry after %d attempts: %v", attempts, err)
+			opts.OnFailure(msg, attempts, err)
+			return nil
+		}
+		msg.Stored = true
+		if batched {
+			return nil
+		}
+
+		for _, event := range msg.Events {
+			anomalyCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := store.PutAnomaly(anomalyCtx, event)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to store %s anomaly: %v", event.AnomalyType, err)
+			}
+		}
+		return nil
+	}}
+}
+
+// write stores a record, retrying failures with backoff until ctx is
+// cancelled. It returns the number of attempts made.
+func write(ctx context.Context, store db.TelemetryStore, timeout time.Duration, maxAttempts int, record db.TelemetryRecord) (int, error) {
+	delay := 200 * time.Millisecond
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		putCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = store.PutTelemetry(putCtx, record)
+		cancel()
+		if err == nil || errors.Is(err, db.ErrDuplicateReading) || attempt >= maxAttempts || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		log.Printf("[%s] Store attempt %d failed, retrying in %v: %v", record.DeviceID, attempt, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return attempt, err
+		}
+		delay *= 2
+	}
+}
+
+// live reports whether a message should still reach the cache, alerts and
+// dashboards. A replayed reading is old news and must not replace the latest
+// reading, nor is there any point once shutdown has cancelled in-flight work.
+func live(ctx context.Context, msg *Message) bool {
+	return !msg.Replay && ctx.Err() == nil
+}
+
+// Cache records the reading as the device's latest, unless the cache already
+// holds a newer one, e.g. when a reading arrives late
+func Cache(latestCache cache.LatestCache, timeout time.Duration) Stage {
+	return stageFunc{name: StageCache, process: func(ctx context.Context, msg *Message) error {
+		if !live(ctx, msg) {
+			return nil
+		}
+
+		t := msg.Telemetry
+		latest := cache.LatestTelemetry{
+			DeviceID:     t.DeviceID,
+			Timestamp:    msg.Validation.Time,
+			HeartRate:    t.Metrics.HeartRate,
+			TempC:        t.Metrics.TempC,
+			SpO2:         t.Metrics.SpO2,
+			Steps:        t.Metrics.Steps,
+			BatteryPct:   t.BatteryPct,
+			FWVersion:    t.FWVersion,
+			AnomalyFlag:  len(msg.Open) > 0,
+			AnomalyType:  strings.Join(msg.Open, ","),
+			QualityFlags: msg.Validation.Flags,
+		}
+		if msg.Score != nil {
+			latest.EWSScore = &msg.Score.Total
+			latest.EWSBand = string(msg.Score.Band)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if cached, err := latestCache.GetLatest(ctx, t.TenantID, t.DeviceID); err == nil && cached.Timestamp.After(latest.Timestamp) {
+			logging.Debugf("[%s] Not caching reading %s, older than the cached %s", t.DeviceID, t.Timestamp, cached.Timestamp.Format(time.RFC3339))
+			return nil
+		}
+		if err := latestCache.SetLatest(ctx, t.TenantID, t.DeviceID, latest); err != nil {
+			log.Printf("Failed to cache latest: %v", err)
+		}
+		return nil
+	}}
+}
+
+// Notify sends an alert for each detected anomaly. With a detector, only
+// findings at or above its notify severity are sent.
+func Notify(notifier Notifier, detector *anomaly.SimpleDetector, timeout time.Duration) Stage {
+	return stageFunc{name: StageNotify, process: func(ctx context.Context, msg *Message) error {
+		if !msg.Anomaly.IsAnomaly || !live(ctx, msg) {
+			return nil
+		}
+		result := msg.Anomaly
+		if detector != nil {
+			if result = detector.Notifiable(result); !result.IsAnomaly {
+				return nil
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := notifier.Notify(ctx, msg.Telemetry, result); err != nil {
+			log.Printf("[%s] Failed to send alert: %v", msg.Telemetry.DeviceID, err)
+		}
+		return nil
+	}}
+}
+
+// Publish sends the reading, and any anomaly, to the dashboards of every API
+// instance
+func Publish(bus pubsub.Bus, timeout time.Duration) Stage {
+	return stageFunc{name: StagePublish, process: func(ctx context.Context, msg *Message) error {
+		if !live(ctx, msg) {
+			return nil
+		}
+
+		publish(ctx, bus, timeout, TelemetryMessage(msg.Telemetry, msg.Validation.Flags, msg.Score))
+		if msg.Anomaly.IsAnomaly {
+			publish(ctx, bus, timeout, AnomalyMessage(msg.Telemetry, msg.Anomaly))
+		}
+		return nil
+	}}
+}
+
+func publish(ctx context.Context, bus pubsub.Bus, timeout time.Duration, msg pubsub.LiveMessage) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := pubsub.PublishLive(ctx, bus, msg); err != nil {
+		log.Printf("[%s] Failed to publish %s update: %v", msg.DeviceID, msg.Type, err)
+	}
+}
+
+// TelemetryMessage builds the live update sent to dashboard WebSockets. score
+// may be nil.
+func TelemetryMessage(telemetry schema.Telemetry, qualityFlags []string, score *anomaly.EarlyWarningScore) pubsub.LiveMessage {
+	data := map[string]interface{}{
+		"hr_bpm":      telemetry.Metrics.HeartRate,
+		"temp_c":      telemetry.Metrics.TempC,
+		"spo2_pct":    telemetry.Metrics.SpO2,
+		"steps":       telemetry.Metrics.Steps,
+		"battery_pct": telemetry.BatteryPct,
+	}
+	if len(qualityFlags) > 0 {
+		data["quality_flags"] = qualityFlags
+	}
+	if score != nil {
+		data["ews_score"] = score.Total
+		data["ews_band"] = score.Band
+		data["ews_sub_scores"] = score.SubScores
+	}
+
+	return pubsub.LiveMessage{
+		Type:      "telemetry",
+		DeviceID:  telemetry.DeviceID,
+		TenantID:  telemetry.TenantID,
+		Timestamp: telemetry.Timestamp,
+		Data:      data,
+	}
+}
+
+// AnomalyMessage builds the live alert sent to dashboard WebSockets
+func AnomalyMessage(telemetry schema.Telemetry, result anomaly.AnomalyResult) pubsub.LiveMessage {
+	return pubsub.LiveMessage{
+		Type:      "anomaly",
+		DeviceID:  telemetry.DeviceID,
+		TenantID:  telemetry.TenantID,
+		Timestamp: telemetry.Timestamp,
+		Data: map[string]interface{}{
+			"anomaly_flag": true,
+			"anomaly_type": result.AnomalyType,
+			"severity":     result.Severity,
+			"reason":       result.Reason,
+			"findings":     result.Findings,
+			"hr_bpm":       telemetry.Metrics.HeartRate,
+			"temp_c":       telemetry.Metrics.TempC,
+			"spo2_pct":     telemetry.Metrics.SpO2,
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+func TestCacheKeepsNewest(t *testing.T) {
+	base := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		cached   time.Time // Zero for an empty cache
+		incoming time.Time
+		replay   bool
+		want     time.Time
+	}{
+		{name: "empty cache", incoming: base, want: base},
+		{name: "newer reading", cached: base, incoming: base.Add(2 * time.Second), want: base.Add(2 * time.Second)},
+		{name: "same timestamp", cached: base, incoming: base, want: base},
+		{name: "late reading", cached: base, incoming: base.Add(-2 * time.Second), want: base},
+		{name: "replayed reading", cached: base, incoming: base.Add(2 * time.Second), replay: true, want: base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			latest := cache.NewMemoryCache()
+			if !tt.cached.IsZero() {
+				if err := latest.SetLatest(ctx, "acme-clinic", "patient-001", cache.LatestTelemetry{DeviceID: "patient-001", Timestamp: tt.cached}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			msg := &Message{
+				Replay:     tt.replay,
+				Telemetry:  schema.Telemetry{TenantID: "acme-clinic", DeviceID: "patient-001", Timestamp: tt.incoming.Format(time.RFC3339)},
+				Validation: schema.Validation{Time: tt.incoming},
+			}
+			if err := Cache(latest, time.Second).Process(ctx, msg); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+
+			got, err := latest.GetLatest(ctx, "acme-clinic", "patient-001")
+			if err != nil {
+				t.Fatalf("GetLatest: %v", err)
+			}
+			if !got.Timestamp.Equal(tt.want) {
+				t.Errorf("cached %v, want %v", got.Timestamp, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheValidatedTime(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	payload := func(ts string) []byte {
+		return []byte(`{"tenant_id":"acme-clinic","device_id":"patient-001","ts":"` + ts + `","metrics":{"hr_bpm":72,"temp_c":36.8,"spo2_pct":98}}`)
+	}
+
+	tests := []struct {
+		name    string
+		ts      string
+		want    time.Time // Zero if nothing should be cached
+		wantErr bool
+	}{
+		{name: "UTC timestamp", ts: "2025-01-06T11:59:58Z", want: now.Add(-2 * time.Second)},
+		{name: "offset timestamp", ts: "2025-01-06T12:59:58+01:00", want: now.Add(-2 * time.Second)},
+		{name: "missing timestamp", ts: "", wantErr: true},
+		{name: "malformed timestamp", ts: "06/01/2025 11:59", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			latest := cache.NewMemoryCache()
+			p, err := Build([]string{StageDecode, StageValidate, StageCache}, Deps{Cache: latest, Now: func() time.Time { return now }})
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			err = p.Process(ctx, &Message{Topic: "tenants/acme-clinic/devices/patient-001/telemetry", Payload: payload(tt.ts)})
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Process error = %v, want error %v", err, tt.wantErr)
+			}
+
+			got, err := latest.GetLatest(ctx, "acme-clinic", "patient-001")
+			if tt.wantErr {
+				if !errors.Is(err, cache.ErrCacheMiss) {
+					t.Errorf("GetLatest error = %v after a rejected reading, want a cache miss", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetLatest: %v", err)
+			}
+			if !got.Timestamp.Equal(tt.want) || got.Timestamp.Location() != time.UTC {
+				t.Errorf("cached %v, want %v in UTC", got.Timestamp, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/pubsub"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+// StaleMonitor finds devices that have stopped sending readings. The detect
+// stage tells it about every live reading, Seed about registered devices that
+// may not report again, and Run or Check looks for silent devices. Each
+// silence is reported once, through whichever of the persist, notify and
+// publish stages the pipeline has. With a sustained detector the silence is
+// also kept as an open condition, so it is not reported again after a restart
+// or by another consumer.
+type StaleMonitor struct {
+	detector *anomaly.SimpleDetector
+	sustain  *anomaly.SustainedDetector
+	registry db.DeviceRegistry
+	history  db.TelemetryStore // Latest readings for seeding
+	store    db.Store
+	cache    cache.LatestCache
+	notifier Notifier
+	bus      pubsub.Bus
+	timeout  time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	devices map[string]*deviceActivity // tenant_id/device_id -> activity
+}
+
+type deviceActivity struct {
+	last     schema.Telemetry // Latest reading
+	seen     time.Time        // When it arrived
+	reported bool             // The current silence has been reported
+}
+
+// newStaleMonitor creates a monitor that reports through the named stages
+func newStaleMonitor(names []string, deps Deps) *StaleMonitor {
+	m := &StaleMonitor{
+		detector: deps.Detector,
+		sustain:  deps.Sustain,
+		registry: deps.Registry,
+		history:  deps.Store,
+		timeout:  deps.Timeout,
+		now:      deps.Now,
+		devices:  make(map[string]*deviceActivity),
+	}
+	if indexOf(names, StagePersist) >= 0 {
+		m.store = deps.Store
+	}
+	if indexOf(names, StageCache) >= 0 {
+		m.cache = deps.Cache
+	}
+	if indexOf(names, StageNotify) >= 0 {
+		m.notifier = deps.Notifier
+	}
+	if indexOf(names, StagePublish) >= 0 {
+		m.bus = deps.Bus
+	}
+	return m
+}
+
+// Seen records a reading from a device
+func (m *StaleMonitor) Seen(t schema.Telemetry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := t.TenantID + "/" + t.DeviceID
+	activity, ok := m.devices[key]
+	if !ok {
+		activity = &deviceActivity{}
+		m.devices[key] = activity
+	} else if activity.reported {
+		log.Printf("[%s] Reporting again after going stale", t.DeviceID)
+	}
+	activity.last = t
+	activity.seen = m.now()
+	activity.reported = false
+}
+
+// Seed watches the active registered devices of the given tenants that the
+// monitor has not seen yet, so that a device that went silent while nothing
+// was running is still reported. A device's latest cached or stored reading
+// tells when it was last seen; one that has never reported is timed from now.
+func (m *StaleMonitor) Seed(ctx context.Context, tenantIDs []string) error {
+	if m.registry == nil {
+		return nil
+	}
+
+	seeded := 0
+	for _, tenantID := range tenantIDs {
+		listCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		devices, err := m.registry.ListDevices(listCtx, tenantID)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to list devices of %s: %w", tenantID, err)
+		}
+
+		for _, device := range devices {
+			if device.Status != db.DeviceStatusActive {
+				continue
+			}
+			if m.seed(ctx, device) {
+				seeded++
+			}
+		}
+	}
+	if seeded > 0 {
+		log.Printf("Watching %d registered devices for silence", seeded)
+	}
+	return nil
+}
+
+// seed adds a registered device, reporting false if it is already watched
+func (m *StaleMonitor) seed(ctx context.Context, device db.Device) bool {
+	key := device.TenantID + "/" + device.DeviceID
+
+	m.mu.Lock()
+	_, known := m.devices[key]
+	m.mu.Unlock()
+	if known {
+		return false
+	}
+
+	activity := &deviceActivity{
+		last: schema.Telemetry{TenantID: device.TenantID, DeviceID: device.DeviceID, FWVersion: device.FWVersion},
+		seen: m.now(),
+	}
+	if last, seen, ok := m.lastReading(ctx, device); ok {
+		activity.last, activity.seen = last, seen
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, known := m.devices[key]; known {
+		return false
+	}
+	m.devices[key] = activity
+	return true
+}
+
+// lastReading finds a device's latest reading, in the cache or else the
+// store, and when it was taken
+func (m *StaleMonitor) lastReading(ctx context.Context, device db.Device) (schema.Telemetry, time.Time, bool) {
+	if m.cache != nil {
+		cacheCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		latest, err := m.cache.GetLatest(cacheCtx, device.TenantID, device.DeviceID)
+		cancel()
+		if err == nil && latest != nil {
+			return latestTelemetry(device.TenantID, *latest), latest.Timestamp, true
+		}
+	}
+
+	if m.history != nil {
+		storeCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		record, err := m.history.GetLatestTelemetry(storeCtx, device.TenantID, device.DeviceID)
+		cancel()
+		if err == nil && record != nil {
+			if ts, err := time.Parse(time.RFC3339, record.Timestamp); err == nil {
+				return recordTelemetry(*record), ts, true
+			}
+		}
+	}
+	return schema.Telemetry{}, time.Time{}, false
+}
+
+// recordTelemetry rebuilds a stored reading
+func recordTelemetry(record db.TelemetryRecord) schema.Telemetry {
+	return schema.Telemetry{
+		TenantID:  record.TenantID,
+		DeviceID:  record.DeviceID,
+		Timestamp: record.Timestamp,
+		Metrics: schema.Metrics{
+			HeartRate: record.HeartRate,
+			TempC:     record.TempC,
+			SpO2:      record.SpO2,
+			Steps:     record.Steps,
+		},
+		BatteryPct: record.BatteryPct,
+		FWVersion:  record.FWVersion,
+	}
+}
+
+// latestTelemetry rebuilds a device's latest reading from the cache
+func latestTelemetry(tenantID string, latest cache.LatestTelemetry) schema.Telemetry {
+	return schema.Telemetry{
+		TenantID:  tenantID,
+		DeviceID:  latest.DeviceID,
+		Timestamp: latest.Timestamp.UTC().Format(time.RFC3339),
+		Metrics: schema.Metrics{
+			HeartRate: latest.HeartRate,
+			TempC:     latest.TempC,
+			SpO2:      latest.SpO2,
+			Steps:     latest.Steps,
+		},
+		BatteryPct: latest.BatteryPct,
+		FWVersion:  latest.FWVersion,
+	}
+}
+
+// Run checks for stale devices every interval until ctx is cancelled
+func (m *StaleMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// Check reports each device whose silence breaks the stale rule
+func (m *StaleMonitor) Check(ctx context.Context) {
+	now := m.now()
+
+	type silent struct {
+		last   schema.Telemetry
+		result anomaly.AnomalyResult
+	}
+	var found []silent
+
+	m.mu.Lock()
+	for _, activity := range m.devices {
+		if activity.reported {
+			continue
+		}
+		result := m.detector.CheckStale(activity.last.TenantID, now.Sub(activity.seen))
+		if result.IsAnomaly {
+			activity.reported = true
+			found = append(found, silent{last: activity.last, result: result})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range found {
+		if m.recentElsewhere(ctx, s.last, now) || !m.open(ctx, s.last, s.result, now) {
+			continue
+		}
+		m.report(ctx, s.last, s.result, now)
+	}
+}
+
+// open keeps the silence as an open condition, reporting false if it already
+// is one and so has been reported
+func (m *StaleMonitor) open(ctx context.Context, last schema.Telemetry, result anomaly.AnomalyResult, now time.Time) bool {
+	if m.sustain == nil || len(result.Findings) == 0 {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	opened, err := m.sustain.Open(ctx, last.TenantID, last.DeviceID, result.Findings[0], now)
+	if err != nil {
+		// Better reported twice than not at all
+		log.Printf("[%s] Failed to record stale device: %v", last.DeviceID, err)
+		return true
+	}
+	return opened
+}
+
+// recentElsewhere checks the shared latest cache, since with a shared
+// subscription another consumer may be receiving the device's readings
+func (m *StaleMonitor) recentElsewhere(ctx context.Context, last schema.Telemetry, now time.Time) bool {
+	if m.cache == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	latest, err := m.cache.GetLatest(ctx, last.TenantID, last.DeviceID)
+	if err != nil || latest == nil {
+		return false
+	}
+
+	if m.detector.CheckStale(last.TenantID, now.Sub(latest.Timestamp)).IsAnomaly {
+		return false
+	}
+
+	// Check again once the newer reading is old enough
+	m.mu.Lock()
+	if activity, ok := m.devices[last.TenantID+"/"+last.DeviceID]; ok && activity.seen.Before(latest.Timestamp) {
+		activity.seen = latest.Timestamp
+		activity.reported = false
+	}
+	m.mu.Unlock()
+	return true
+}
+
+// report stores, alerts on and publishes a stale device finding. The device's
+// last reading supplies the vitals; the finding is timed when it was made.
+func (m *StaleMonitor) report(ctx context.Context, last schema.Telemetry, result anomaly.AnomalyResult, now time.Time) {
+	t := last
+	t.Timestamp = now.UTC().Format(time.RFC3339)
+	log.Printf("[%s] ANOMALY DETECTED: %s - %s", t.DeviceID, result.AnomalyType, result.Reason)
+
+	if m.store != nil {
+		for _, event := range anomalyEvents(t, result) {
+			storeCtx, cancel := context.WithTimeout(ctx, m.timeout)
+			err := m.store.PutAnomaly(storeCtx, event)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to store %s anomaly: %v", event.AnomalyType, err)
+			}
+		}
+	}
+
+	if notify := m.detector.Notifiable(result); m.notifier != nil && notify.IsAnomaly {
+		notifyCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		err := m.notifier.Notify(notifyCtx, t, notify)
+		cancel()
+		if err != nil {
+			log.Printf("[%s] Failed to send alert: %v", t.DeviceID, err)
+		}
+	}
+
+	if m.bus != nil {
+		publish(ctx, m.bus, m.timeout, AnomalyMessage(t, result))
+	}
+}
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/anomaly"
+	"github.com/meghanan266/healthsense/backend/pkg/cache"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+	"github.com/meghanan266/healthsense/backend/pkg/schema"
+)
+
+// recordingNotifier remembers which devices it alerted about
+type recordingNotifier struct {
+	mu      sync.Mutex
+	devices []string
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, t schema.Telemetry, result anomaly.AnomalyResult) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.devices = append(n.devices, t.DeviceID)
+	return nil
+}
+
+func TestStaleMonitorSeed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	store := db.NewMemoryStore()
+	latest := cache.NewMemoryCache()
+
+	register := func(deviceID, status string) {
+		t.Helper()
+		if _, err := store.CreateDevice(ctx, db.Device{TenantID: "acme-clinic", DeviceID: deviceID, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored := func(deviceID string, at time.Time) {
+		t.Helper()
+		record := db.TelemetryRecord{TenantID: "acme-clinic", DeviceID: deviceID, Timestamp: at.Format(time.RFC3339), HeartRate: 72, SpO2: 98}
+		if err := store.PutTelemetry(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cached := func(deviceID string, at time.Time) {
+		t.Helper()
+		if err := latest.SetLatest(ctx, "acme-clinic", deviceID, cache.LatestTelemetry{DeviceID: deviceID, Timestamp: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stale by default after 5 missed 2s readings
+	register("stored-silent", db.DeviceStatusActive)
+	stored("stored-silent", now.Add(-10*time.Minute))
+	register("cached-silent", db.DeviceStatusActive)
+	cached("cached-silent", now.Add(-time.Minute))
+	register("cached-live", db.DeviceStatusActive)
+	stored("cached-live", now.Add(-10*time.Minute))
+	cached("cached-live", now.Add(-time.Second))
+	register("never-reported", db.DeviceStatusActive)
+	register("inactive", db.DeviceStatusInactive)
+	stored("inactive", now.Add(-10*time.Minute))
+
+	notifier := &recordingNotifier{}
+	p, err := Build([]string{StageDecode, StageValidate, StageDetect, StageCache, StageNotify}, Deps{
+		Registry: store,
+		Detector: anomaly.NewSimpleDetector(),
+		Store:    store,
+		Cache:    latest,
+		Notifier: notifier,
+		Now:      func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	monitor := p.StaleMonitor()
+	if err := monitor.Seed(ctx, []string{"acme-clinic"}); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	monitor.Check(ctx)
+
+	sort.Strings(notifier.devices)
+	if want := []string{"cached-silent", "stored-silent"}; !reflect.DeepEqual(notifier.devices, want) {
+		t.Errorf("reported %v, want %v", notifier.devices, want)
+	}
+}
@@ -0,0 +1,27 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// LiveMessage is a live update for dashboard WebSockets
+type LiveMessage struct {
+	Type      string      `json:"type"`
+	DeviceID  string      `json:"device_id,omitempty"`
+	TenantID  string      `json:"tenant_id,omitempty"`
+	Timestamp string      `json:"timestamp,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// PublishLive sends a message to the WebSocket clients of the message's
+// tenant on every API instance subscribed to bus
+func PublishLive(ctx context.Context, bus Bus, msg LiveMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal live update: %w", err)
+	}
+
+	return bus.Publish(ctx, msg.TenantID, payload)
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBus delivers events to subscribers in the same process. An event is
+// dropped for a subscriber whose buffer is full rather than blocking the
+// publisher.
+type MemoryBus struct {
+	mu     sync.RWMutex
+	subs   map[chan Message]struct{}
+	closed bool
+}
+
+// NewMemoryBus creates a bus with no subscribers
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subs: make(map[chan Message]struct{})}
+}
+
+// Publish delivers an event to every current subscriber
+func (b *MemoryBus) Publish(ctx context.Context, tenantID string, payload []byte) error {
+	msg := Message{TenantID: tenantID, Payload: payload}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case sub <- msg:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe receives events published from now on
+func (b *MemoryBus) Subscribe(ctx context.Context) (<-chan Message, error) {
+	sub := make(chan Message, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		close(sub)
+		b.mu.Unlock()
+		return sub, nil
+	}
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(sub)
+	}()
+
+	return sub, nil
+}
+
+func (b *MemoryBus) unsubscribe(sub chan Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub)
+	}
+}
+
+// Close ends all subscriptions
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package pubsub
+
+import "context"
+
+// Message is a live event published for one tenant
+type Message struct {
+	TenantID string
+	Payload  []byte
+}
+
+// Bus fans live events out to every subscriber. Delivery is best effort:
+// subscribers that are not connected, or fall too far behind, miss events.
+type Bus interface {
+	Publish(ctx context.Context, tenantID string, payload []byte) error
+	// Subscribe receives the events of every tenant until ctx is cancelled
+	// or the bus is closed, when the channel is closed
+	Subscribe(ctx context.Context) (<-chan Message, error)
+	Close() error
+}
+
+var (
+	_ Bus = (*RedisBus)(nil)
+	_ Bus = (*MemoryBus)(nil)
+)
+
+// subscriberBuffer is how many events a slow subscriber can fall behind
+const subscriberBuffer = 256
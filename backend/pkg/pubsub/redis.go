@@ -0,0 +1,106 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// channelPrefix is followed by the tenant ID, one Redis channel per tenant
+const channelPrefix = "live:"
+
+// RedisBus publishes events on Redis pub/sub, so every process subscribed to
+// the same Redis sees them
+type RedisBus struct {
+	client *redis.Client
+
+	mu   sync.Mutex
+	subs map[*redis.PubSub]struct{}
+}
+
+// NewRedisBus connects to Redis
+func NewRedisBus(addr, password string) (*RedisBus, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisBus{client: client, subs: make(map[*redis.PubSub]struct{})}, nil
+}
+
+// Publish sends an event to the tenant's channel
+func (b *RedisBus) Publish(ctx context.Context, tenantID string, payload []byte) error {
+	if err := b.client.Publish(ctx, channelPrefix+tenantID, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe listens on every tenant's channel. The subscription is confirmed
+// before it returns, and is restored automatically if the connection drops.
+func (b *RedisBus) Subscribe(ctx context.Context) (<-chan Message, error) {
+	sub := b.client.PSubscribe(ctx, channelPrefix+"*")
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	out := make(chan Message, subscriberBuffer)
+	go func() {
+		defer close(out)
+		defer b.unsubscribe(sub)
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				event := Message{
+					TenantID: strings.TrimPrefix(msg.Channel, channelPrefix),
+					Payload:  []byte(msg.Payload),
+				}
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (b *RedisBus) unsubscribe(sub *redis.PubSub) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+
+	sub.Close()
+}
+
+// Close ends all subscriptions and closes the Redis connection
+func (b *RedisBus) Close() error {
+	b.mu.Lock()
+	for sub := range b.subs {
+		sub.Close()
+	}
+	b.mu.Unlock()
+
+	return b.client.Close()
+}
@@ -0,0 +1,166 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Telemetry is a reading as published by a device
+type Telemetry struct {
+	TenantID   string  `json:"tenant_id"`
+	DeviceID   string  `json:"device_id"`
+	Timestamp  string  `json:"ts"`
+	Metrics    Metrics `json:"metrics"`
+	BatteryPct int     `json:"battery_pct"`
+	FWVersion  string  `json:"fw_version"`
+	MessageID  string  `json:"msg_id,omitempty"` // Optional, unique per device
+	Seq        int64   `json:"seq,omitempty"`    // Optional, increasing per device
+}
+
+type Metrics struct {
+	HeartRate int     `json:"hr_bpm"`
+	TempC     float64 `json:"temp_c"`
+	SpO2      int     `json:"spo2_pct"`
+	Steps     int     `json:"steps"`
+}
+
+// Quality flags mark readings that are stored but should not be trusted as-is
+const (
+	FlagHeartRateRange = "hr_out_of_range"
+	FlagTempRange      = "temp_out_of_range"
+	FlagSpO2Range      = "spo2_out_of_range"
+	FlagStepsRange     = "steps_out_of_range"
+	FlagBatteryRange   = "battery_out_of_range"
+	FlagFutureTime     = "future_timestamp"
+	FlagLateTime       = "late_timestamp"
+)
+
+// Plausible ranges for a worn device. Values outside them usually mean a
+// sensor fault or a device off the wrist rather than a patient state.
+const (
+	MinHeartRate = 25
+	MaxHeartRate = 250
+	MinTempC     = 30.0
+	MaxTempC     = 43.0
+	MinSpO2      = 50
+	MaxSpO2      = 100
+)
+
+// Readings stamped further ahead than MaxClockSkew, or older than MaxAge, are
+// flagged rather than rejected, since they may come from a drifting clock or
+// a device that was offline
+const (
+	MaxClockSkew = 5 * time.Minute
+	MaxAge       = 24 * time.Hour
+)
+
+// ValidationError lists why a reading was rejected
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid telemetry: " + strings.Join(e.Problems, "; ")
+}
+
+// Validation is the outcome of validating an accepted reading
+type Validation struct {
+	Time  time.Time // Parsed timestamp, in UTC
+	Flags []string  // Quality flags; empty for a clean reading
+}
+
+// VitalsTrusted reports whether every vital sign is within its plausible
+// range, so the reading can be used for anomaly detection
+func (v Validation) VitalsTrusted() bool {
+	for _, flag := range v.Flags {
+		switch flag {
+		case FlagHeartRateRange, FlagTempRange, FlagSpO2Range:
+			return false
+		}
+	}
+	return true
+}
+
+// Flagged reports whether the reading carries a quality flag
+func (v Validation) Flagged(flag string) bool {
+	for _, f := range v.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a reading received on topic. Missing identifiers, a missing
+// or malformed timestamp, or identifiers that disagree with a
+// tenants/{tenant}/devices/{device}/... topic reject the reading with a
+// *ValidationError. Implausible values are accepted but flagged. An empty
+// topic skips the topic check.
+func Validate(t Telemetry, topic string, now time.Time) (Validation, error) {
+	var result Validation
+	problems := make([]string, 0)
+
+	if t.TenantID == "" {
+		problems = append(problems, "tenant_id is required")
+	}
+	if t.DeviceID == "" {
+		problems = append(problems, "device_id is required")
+	}
+
+	if t.Timestamp == "" {
+		problems = append(problems, "ts is required")
+	} else if ts, err := time.Parse(time.RFC3339, t.Timestamp); err != nil {
+		problems = append(problems, fmt.Sprintf("ts %q is not an RFC3339 timestamp", t.Timestamp))
+	} else {
+		result.Time = ts.UTC()
+	}
+
+	if tenant, device, ok := ParseTopic(topic); ok {
+		if t.TenantID != "" && tenant != t.TenantID {
+			problems = append(problems, fmt.Sprintf("tenant_id %q does not match topic tenant %q", t.TenantID, tenant))
+		}
+		if t.DeviceID != "" && device != t.DeviceID {
+			problems = append(problems, fmt.Sprintf("device_id %q does not match topic device %q", t.DeviceID, device))
+		}
+	}
+
+	if len(problems) > 0 {
+		return Validation{}, &ValidationError{Problems: problems}
+	}
+
+	m := t.Metrics
+	if m.HeartRate < MinHeartRate || m.HeartRate > MaxHeartRate {
+		result.Flags = append(result.Flags, FlagHeartRateRange)
+	}
+	if m.TempC < MinTempC || m.TempC > MaxTempC {
+		result.Flags = append(result.Flags, FlagTempRange)
+	}
+	if m.SpO2 < MinSpO2 || m.SpO2 > MaxSpO2 {
+		result.Flags = append(result.Flags, FlagSpO2Range)
+	}
+	if m.Steps < 0 {
+		result.Flags = append(result.Flags, FlagStepsRange)
+	}
+	if t.BatteryPct < 0 || t.BatteryPct > 100 {
+		result.Flags = append(result.Flags, FlagBatteryRange)
+	}
+
+	if result.Time.After(now.Add(MaxClockSkew)) {
+		result.Flags = append(result.Flags, FlagFutureTime)
+	} else if result.Time.Before(now.Add(-MaxAge)) {
+		result.Flags = append(result.Flags, FlagLateTime)
+	}
+
+	return result, nil
+}
+
+// ParseTopic extracts the tenant and device from a
+// tenants/{tenant}/devices/{device}/... topic
+func ParseTopic(topic string) (tenant, device string, ok bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 4 || parts[0] != "tenants" || parts[2] != "devices" {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
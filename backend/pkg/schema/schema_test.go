@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	const topic = "tenants/acme-clinic/devices/patient-001/telemetry"
+
+	valid := Telemetry{
+		TenantID:   "acme-clinic",
+		DeviceID:   "patient-001",
+		Timestamp:  "2025-01-06T11:59:58Z",
+		Metrics:    Metrics{HeartRate: 72, TempC: 36.8, SpO2: 98, Steps: 1200},
+		BatteryPct: 85,
+	}
+	with := func(change func(*Telemetry)) Telemetry {
+		t := valid
+		change(&t)
+		return t
+	}
+
+	tests := []struct {
+		name      string
+		telemetry Telemetry
+		topic     string
+		wantTime  time.Time
+		wantFlags []string
+		untrusted bool   // Vitals unfit for anomaly detection
+		wantErr   string // Part of the error; empty if the reading is accepted
+	}{
+		{name: "clean reading", telemetry: valid, topic: topic, wantTime: now.Add(-2 * time.Second)},
+		{name: "offset timestamp normalised to UTC", telemetry: with(func(t *Telemetry) { t.Timestamp = "2025-01-06T12:59:58+01:00" }), topic: topic, wantTime: now.Add(-2 * time.Second)},
+		{name: "no topic check without a topic", telemetry: with(func(t *Telemetry) { t.DeviceID = "patient-002" }), wantTime: now.Add(-2 * time.Second)},
+		{name: "unrecognised topic not checked", telemetry: valid, topic: "healthsense/telemetry", wantTime: now.Add(-2 * time.Second)},
+		{name: "missing tenant", telemetry: with(func(t *Telemetry) { t.TenantID = "" }), topic: topic, wantErr: "tenant_id is required"},
+		{name: "missing device", telemetry: with(func(t *Telemetry) { t.DeviceID = "" }), topic: topic, wantErr: "device_id is required"},
+		{name: "missing timestamp", telemetry: with(func(t *Telemetry) { t.Timestamp = "" }), topic: topic, wantErr: "ts is required"},
+		{name: "malformed timestamp", telemetry: with(func(t *Telemetry) { t.Timestamp = "2025-01-06 11:59:58" }), topic: topic, wantErr: "not an RFC3339 timestamp"},
+		{name: "tenant mismatch", telemetry: with(func(t *Telemetry) { t.TenantID = "other-clinic" }), topic: topic, wantErr: `does not match topic tenant "acme-clinic"`},
+		{name: "device mismatch", telemetry: with(func(t *Telemetry) { t.DeviceID = "patient-002" }), topic: topic, wantErr: `does not match topic device "patient-001"`},
+		{
+			name:      "implausible vitals flagged",
+			telemetry: with(func(t *Telemetry) { t.Metrics = Metrics{HeartRate: 0, TempC: 45, SpO2: 101, Steps: -1} }),
+			topic:     topic,
+			wantTime:  now.Add(-2 * time.Second),
+			wantFlags: []string{FlagHeartRateRange, FlagTempRange, FlagSpO2Range, FlagStepsRange},
+			untrusted: true,
+		},
+		{
+			name: "range bounds accepted",
+			telemetry: with(func(t *Telemetry) {
+				t.Metrics = Metrics{HeartRate: MaxHeartRate, TempC: MinTempC, SpO2: MaxSpO2}
+				t.BatteryPct = 0
+			}),
+			topic:    topic,
+			wantTime: now.Add(-2 * time.Second),
+		},
+		{name: "battery out of range", telemetry: with(func(t *Telemetry) { t.BatteryPct = 101 }), topic: topic, wantTime: now.Add(-2 * time.Second), wantFlags: []string{FlagBatteryRange}},
+		{name: "future timestamp", telemetry: with(func(t *Telemetry) { t.Timestamp = "2025-01-06T12:10:00Z" }), topic: topic, wantTime: now.Add(10 * time.Minute), wantFlags: []string{FlagFutureTime}},
+		{name: "within clock skew", telemetry: with(func(t *Telemetry) { t.Timestamp = "2025-01-06T12:04:00Z" }), topic: topic, wantTime: now.Add(4 * time.Minute)},
+		{name: "late timestamp", telemetry: with(func(t *Telemetry) { t.Timestamp = "2025-01-04T12:00:00Z" }), topic: topic, wantTime: now.Add(-48 * time.Hour), wantFlags: []string{FlagLateTime}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Validate(tt.telemetry, tt.topic, now)
+			if tt.wantErr != "" {
+				var verr *ValidationError
+				if !errors.As(err, &verr) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate error = %v, want a *ValidationError containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+
+			if !got.Time.Equal(tt.wantTime) || got.Time.Location() != time.UTC {
+				t.Errorf("time %v, want %v in UTC", got.Time, tt.wantTime)
+			}
+			if !reflect.DeepEqual(got.Flags, tt.wantFlags) {
+				t.Errorf("flags %v, want %v", got.Flags, tt.wantFlags)
+			}
+			if got.VitalsTrusted() == tt.untrusted {
+				t.Errorf("VitalsTrusted = %v, want %v", got.VitalsTrusted(), !tt.untrusted)
+			}
+		})
+	}
+}
+
+func TestParseTopic(t *testing.T) {
+	tests := []struct {
+		topic          string
+		tenant, device string
+		ok             bool
+	}{
+		{topic: "tenants/acme-clinic/devices/patient-001/telemetry", tenant: "acme-clinic", device: "patient-001", ok: true},
+		{topic: "tenants/acme-clinic/devices/patient-001", tenant: "acme-clinic", device: "patient-001", ok: true},
+		{topic: "tenants/acme-clinic/patients/patient-001/telemetry"},
+		{topic: "tenants/acme-clinic"},
+		{topic: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			tenant, device, ok := ParseTopic(tt.topic)
+			if tenant != tt.tenant || device != tt.device || ok != tt.ok {
+				t.Errorf("ParseTopic = %q, %q, %v, want %q, %q, %v", tenant, device, ok, tt.tenant, tt.device, tt.ok)
+			}
+		})
+	}
+}
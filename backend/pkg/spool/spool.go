@@ -0,0 +1,549 @@
+package spool
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// DefaultSegmentBytes is the size at which the open segment is sealed
+const DefaultSegmentBytes = 4 << 20
+
+const (
+	segmentPrefix = "segment-"
+	openSuffix    = ".open"   // Being appended to, in arrival order
+	sealedSuffix  = ".ndjson" // Complete, sorted by reading timestamp
+)
+
+// Entry is a reading waiting to be stored, with the anomaly events detected
+// for it, if any
+type Entry struct {
+	SpooledAt time.Time          `json:"spooled_at"`
+	Record    db.TelemetryRecord `json:"record"`
+	Anomalies []db.AnomalyEvent  `json:"anomalies,omitempty"`
+}
+
+// Spool is a write-ahead log of readings that could not be stored, kept as
+// NDJSON segment files in a directory. Entries are appended and synced to an
+// open segment, which is sealed when it reaches the size limit or a drain
+// starts. Sealing sorts a segment by reading timestamp, so a drain can merge
+// the sealed segments in timestamp order.
+type Spool struct {
+	dir          string
+	segmentBytes int64
+
+	mu       sync.Mutex // guards everything below
+	open     *os.File
+	openSeg  *segment
+	openSize int64
+	nextSeq  uint64
+	sealed   []*segment // In sequence order
+
+	draining sync.Mutex // One drain at a time
+}
+
+// segment describes one segment file
+type segment struct {
+	seq    uint64
+	path   string
+	count  int64
+	oldest time.Time // Earliest SpooledAt
+}
+
+// Open opens the spool in dir, creating the directory if needed. Segments
+// left open by a previous run are sealed.
+func Open(dir string, segmentBytes int64) (*Spool, error) {
+	if segmentBytes <= 0 {
+		segmentBytes = DefaultSegmentBytes
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, segmentBytes: segmentBytes, nextSeq: 1}
+
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, segmentPrefix) {
+			continue
+		}
+
+		var seq uint64
+		var suffix string
+		switch {
+		case strings.HasSuffix(name, openSuffix):
+			suffix = openSuffix
+		case strings.HasSuffix(name, sealedSuffix):
+			suffix = sealedSuffix
+		default:
+			continue
+		}
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), suffix), "%d", &seq); err != nil {
+			continue
+		}
+
+		seg := &segment{seq: seq, path: filepath.Join(dir, name)}
+		if suffix == openSuffix {
+			// A crash between sealing and removing the open segment leaves
+			// both; the sealed copy is complete
+			if _, err := os.Stat(s.segmentPath(seq, sealedSuffix)); err == nil {
+				os.Remove(seg.path)
+				continue
+			}
+			s.seal(seg)
+		}
+		if err := scanSegment(seg); err != nil {
+			return nil, err
+		}
+
+		s.sealed = append(s.sealed, seg)
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(s.sealed, func(i, j int) bool { return s.sealed[i].seq < s.sealed[j].seq })
+
+	return s, nil
+}
+
+// Append adds an entry and syncs it to disk
+func (s *Spool) Append(entry Entry) error {
+	if entry.SpooledAt.IsZero() {
+		entry.SpooledAt = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode spool entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.open == nil {
+		seg := &segment{seq: s.nextSeq, path: s.segmentPath(s.nextSeq, openSuffix)}
+		file, err := os.OpenFile(seg.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to create spool segment: %w", err)
+		}
+		s.nextSeq++
+		s.open, s.openSeg, s.openSize = file, seg, 0
+	}
+
+	// After a failed write the segment may end in a partial line, so later
+	// entries go to a new one
+	if _, err := s.open.Write(line); err != nil {
+		s.sealOpen()
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+	if err := s.open.Sync(); err != nil {
+		s.sealOpen()
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+
+	s.openSize += int64(len(line))
+	s.openSeg.count++
+	if s.openSeg.oldest.IsZero() || entry.SpooledAt.Before(s.openSeg.oldest) {
+		s.openSeg.oldest = entry.SpooledAt
+	}
+
+	if s.openSize >= s.segmentBytes {
+		s.sealOpen()
+	}
+
+	return nil
+}
+
+// Depth returns the number of entries in the spool
+func (s *Spool) Depth() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depth := int64(0)
+	for _, seg := range s.segments() {
+		depth += seg.count
+	}
+	return depth
+}
+
+// Oldest returns when the oldest entry was spooled, or the zero time if the
+// spool is empty
+func (s *Spool) Oldest() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldest time.Time
+	for _, seg := range s.segments() {
+		if seg.count > 0 && (oldest.IsZero() || seg.oldest.Before(oldest)) {
+			oldest = seg.oldest
+		}
+	}
+	return oldest
+}
+
+// Drain seals the open segment and passes every entry to write in reading
+// timestamp order, deleting segments as they are used up. It stops at the
+// first error from write or when ctx is done, keeping the entries not yet
+// written, and returns the number written. Entries appended during a drain
+// are left for the next one.
+func (s *Spool) Drain(ctx context.Context, write func(Entry) error) (int, error) {
+	s.draining.Lock()
+	defer s.draining.Unlock()
+
+	s.mu.Lock()
+	s.sealOpen()
+	segments := append([]*segment(nil), s.sealed...)
+	s.mu.Unlock()
+
+	cursors := make(cursorHeap, 0, len(segments))
+	for _, seg := range segments {
+		c, err := openCursor(seg)
+		if err != nil {
+			for _, opened := range cursors {
+				opened.file.Close()
+			}
+			return 0, err
+		}
+		if c.next() {
+			cursors = append(cursors, c)
+		} else {
+			c.file.Close()
+			s.remove(seg)
+		}
+	}
+	heap.Init(&cursors)
+
+	written := 0
+	var drainErr error
+
+	for len(cursors) > 0 {
+		if drainErr = ctx.Err(); drainErr != nil {
+			break
+		}
+
+		c := cursors[0]
+		if drainErr = write(c.entry); drainErr != nil {
+			break
+		}
+		written++
+		c.consumed++
+
+		if c.next() {
+			heap.Fix(&cursors, 0)
+			continue
+		}
+
+		heap.Pop(&cursors)
+		c.file.Close()
+		if c.err != nil {
+			drainErr = c.err
+			break
+		}
+		s.remove(c.seg)
+	}
+
+	// Whatever was written is a prefix of each remaining segment
+	for _, c := range cursors {
+		c.file.Close()
+		if c.consumed > 0 {
+			if err := s.trim(c.seg, c.consumed); err != nil {
+				log.Printf("Failed to trim spool segment %s, its first %d entries will be written again: %v", c.seg.path, c.consumed, err)
+			}
+		}
+	}
+
+	return written, drainErr
+}
+
+// Close closes the open segment. It is sealed when the spool is next opened.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.open == nil {
+		return nil
+	}
+	err := s.open.Close()
+	s.open = nil
+	return err
+}
+
+// segments returns every segment, sealed and open. s.mu must be held.
+func (s *Spool) segments() []*segment {
+	if s.openSeg == nil {
+		return s.sealed
+	}
+	return append(append([]*segment(nil), s.sealed...), s.openSeg)
+}
+
+// sealOpen closes and seals the open segment, if any. s.mu must be held.
+func (s *Spool) sealOpen() {
+	if s.open == nil {
+		return
+	}
+
+	s.open.Close()
+	s.seal(s.openSeg)
+	s.sealed = append(s.sealed, s.openSeg)
+	s.open, s.openSeg, s.openSize = nil, nil, 0
+}
+
+// seal sorts an open segment by reading timestamp into a sealed segment. If
+// that fails the segment is left as it is, to be drained in arrival order.
+func (s *Spool) seal(seg *segment) {
+	lines, err := readLines(seg.path)
+	if err != nil {
+		log.Printf("Failed to seal spool segment %s: %v", seg.path, err)
+		return
+	}
+
+	// Undecodable lines sort first, and are skipped by the drain
+	seg.count, seg.oldest = 0, time.Time{}
+	times := make([]time.Time, len(lines))
+	for i, line := range lines {
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		times[i], _ = time.Parse(time.RFC3339, entry.Record.Timestamp)
+		seg.count++
+		if seg.oldest.IsZero() || entry.SpooledAt.Before(seg.oldest) {
+			seg.oldest = entry.SpooledAt
+		}
+	}
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]].Before(times[order[b]]) })
+
+	sorted := make([][]byte, len(lines))
+	for i, idx := range order {
+		sorted[i] = lines[idx]
+	}
+
+	sealedPath := s.segmentPath(seg.seq, sealedSuffix)
+	if err := writeLines(sealedPath, sorted); err != nil {
+		log.Printf("Failed to seal spool segment %s: %v", seg.path, err)
+		return
+	}
+	if err := os.Remove(seg.path); err != nil {
+		log.Printf("Failed to remove sealed spool segment %s: %v", seg.path, err)
+	}
+	seg.path = sealedPath
+}
+
+// trim drops the first n entries of a sealed segment
+func (s *Spool) trim(seg *segment, n int64) error {
+	lines, err := readLines(seg.path)
+	if err != nil {
+		return err
+	}
+	if int64(len(lines)) < n {
+		n = int64(len(lines))
+	}
+	if err := writeLines(seg.path, lines[n:]); err != nil {
+		return err
+	}
+
+	trimmed := &segment{seq: seg.seq, path: seg.path}
+	if err := scanSegment(trimmed); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	seg.count, seg.oldest = trimmed.count, trimmed.oldest
+	s.mu.Unlock()
+
+	return nil
+}
+
+// remove deletes a used up segment
+func (s *Spool) remove(seg *segment) {
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove spool segment %s: %v", seg.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, sealed := range s.sealed {
+		if sealed == seg {
+			s.sealed = append(s.sealed[:i], s.sealed[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *Spool) segmentPath(seq uint64, suffix string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, suffix))
+}
+
+// scanSegment counts a segment's entries and finds the oldest
+func scanSegment(seg *segment) error {
+	lines, err := readLines(seg.path)
+	if err != nil {
+		return err
+	}
+
+	seg.count, seg.oldest = 0, time.Time{}
+	for _, line := range lines {
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		seg.count++
+		if seg.oldest.IsZero() || entry.SpooledAt.Before(seg.oldest) {
+			seg.oldest = entry.SpooledAt
+		}
+	}
+
+	return nil
+}
+
+func readLines(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	lines := make([][]byte, 0)
+	scanner := newScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spool segment: %w", err)
+	}
+
+	return lines, nil
+}
+
+// writeLines replaces path with lines, atomically
+func writeLines(path string, lines [][]byte) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	for _, line := range lines {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close spool segment: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace spool segment: %w", err)
+	}
+	return nil
+}
+
+func newScanner(file *os.File) *bufio.Scanner {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return scanner
+}
+
+// cursor reads one segment during a drain
+type cursor struct {
+	seg      *segment
+	file     *os.File
+	scanner  *bufio.Scanner
+	entry    Entry
+	ts       time.Time
+	consumed int64 // Lines used up, written or skipped
+	err      error
+}
+
+func openCursor(seg *segment) (*cursor, error) {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	return &cursor{seg: seg, file: file, scanner: newScanner(file)}, nil
+}
+
+// next loads the next entry, skipping lines that cannot be decoded, such as
+// one cut short by a crash. It reports false at the end of the segment.
+func (c *cursor) next() bool {
+	for c.scanner.Scan() {
+		line := c.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			log.Printf("Skipping corrupt entry in spool segment %s: %v", c.seg.path, err)
+			c.consumed++
+			continue
+		}
+
+		c.entry = entry
+		c.ts, _ = time.Parse(time.RFC3339, entry.Record.Timestamp)
+		return true
+	}
+
+	if err := c.scanner.Err(); err != nil {
+		c.err = fmt.Errorf("failed to read spool segment: %w", err)
+	}
+	return false
+}
+
+// cursorHeap orders cursors by their current entry's timestamp, then by
+// segment, so that equal timestamps keep arrival order
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int { return len(h) }
+
+func (h cursorHeap) Less(i, j int) bool {
+	if !h[i].ts.Equal(h[j].ts) {
+		return h[i].ts.Before(h[j].ts)
+	}
+	return h[i].seg.seq < h[j].seg.seq
+}
+
+func (h cursorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *cursorHeap) Push(x any) { *h = append(*h, x.(*cursor)) }
+
+func (h *cursorHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,340 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+var errStore = errors.New("store unavailable")
+
+func entry(device, ts string) Entry {
+	return Entry{
+		SpooledAt: time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC),
+		Record:    db.TelemetryRecord{TenantID: "acme-clinic", DeviceID: device, Timestamp: ts},
+	}
+}
+
+// key identifies an entry in test expectations
+func key(e Entry) string {
+	return e.Record.DeviceID + "@" + e.Record.Timestamp
+}
+
+func openSpool(t *testing.T, dir string) *Spool {
+	t.Helper()
+	s, err := Open(dir, DefaultSegmentBytes)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func appendAll(t *testing.T, s *Spool, entries ...Entry) {
+	t.Helper()
+	for _, e := range entries {
+		if err := s.Append(e); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+}
+
+// seal closes the open segment, as a drain or a full segment would
+func seal(s *Spool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealOpen()
+}
+
+// drainAll drains the spool, failing the write after limit entries if limit
+// is not negative
+func drainAll(t *testing.T, s *Spool, limit int) ([]string, error) {
+	t.Helper()
+	var got []string
+	_, err := s.Drain(context.Background(), func(e Entry) error {
+		if limit >= 0 && len(got) == limit {
+			return errStore
+		}
+		got = append(got, key(e))
+		return nil
+	})
+	return got, err
+}
+
+// writeSegment writes raw lines to a segment file, as a previous run left it
+func writeSegment(t *testing.T, dir, name string, lines ...string) {
+	t.Helper()
+	data := strings.Join(lines, "\n")
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func line(t *testing.T, e Entry) string {
+	t.Helper()
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+func TestDrainMergesSegmentsByTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments [][]Entry // Appended in this order, each sealed before the next
+		want     []string
+	}{
+		{
+			name: "one segment sorted on seal",
+			segments: [][]Entry{{
+				entry("d1", "2025-01-06T12:00:03Z"),
+				entry("d1", "2025-01-06T12:00:01Z"),
+				entry("d1", "2025-01-06T12:00:02Z"),
+			}},
+			want: []string{"d1@2025-01-06T12:00:01Z", "d1@2025-01-06T12:00:02Z", "d1@2025-01-06T12:00:03Z"},
+		},
+		{
+			name: "interleaved segments",
+			segments: [][]Entry{
+				{entry("d1", "2025-01-06T12:00:01Z"), entry("d1", "2025-01-06T12:00:04Z")},
+				{entry("d2", "2025-01-06T12:00:03Z"), entry("d2", "2025-01-06T12:00:02Z")},
+				{entry("d3", "2025-01-06T12:00:05Z")},
+			},
+			want: []string{
+				"d1@2025-01-06T12:00:01Z", "d2@2025-01-06T12:00:02Z", "d2@2025-01-06T12:00:03Z",
+				"d1@2025-01-06T12:00:04Z", "d3@2025-01-06T12:00:05Z",
+			},
+		},
+		{
+			name: "equal timestamps keep arrival order",
+			segments: [][]Entry{
+				{entry("d2", "2025-01-06T12:00:01Z"), entry("d1", "2025-01-06T12:00:01Z")},
+				{entry("d3", "2025-01-06T12:00:01Z")},
+			},
+			want: []string{"d2@2025-01-06T12:00:01Z", "d1@2025-01-06T12:00:01Z", "d3@2025-01-06T12:00:01Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openSpool(t, dir)
+			total := 0
+			for _, seg := range tt.segments {
+				appendAll(t, s, seg...)
+				seal(s)
+				total += len(seg)
+			}
+			if depth := s.Depth(); depth != int64(total) {
+				t.Fatalf("Depth = %d, want %d", depth, total)
+			}
+
+			got, err := drainAll(t, s, -1)
+			if err != nil {
+				t.Fatalf("Drain: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("drained %v, want %v", got, tt.want)
+			}
+			if depth := s.Depth(); depth != 0 {
+				t.Errorf("Depth after drain = %d, want 0", depth)
+			}
+			if files := segmentFiles(t, dir); len(files) != 0 {
+				t.Errorf("segments left after drain: %v", files)
+			}
+		})
+	}
+}
+
+func TestDrainTrimsAfterFailure(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir)
+	appendAll(t, s,
+		entry("d1", "2025-01-06T12:00:01Z"),
+		entry("d1", "2025-01-06T12:00:03Z"),
+	)
+	seal(s)
+	appendAll(t, s,
+		entry("d2", "2025-01-06T12:00:02Z"),
+		entry("d2", "2025-01-06T12:00:04Z"),
+	)
+
+	got, err := drainAll(t, s, 2)
+	if !errors.Is(err, errStore) {
+		t.Fatalf("Drain error = %v, want %v", err, errStore)
+	}
+	want := []string{"d1@2025-01-06T12:00:01Z", "d2@2025-01-06T12:00:02Z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("first drain wrote %v, want %v", got, want)
+	}
+	if depth := s.Depth(); depth != 2 {
+		t.Errorf("Depth after partial drain = %d, want 2", depth)
+	}
+
+	// The written prefix of each segment is gone, also after a restart
+	s.Close()
+	s = openSpool(t, dir)
+	if depth := s.Depth(); depth != 2 {
+		t.Errorf("Depth after reopening = %d, want 2", depth)
+	}
+	got, err = drainAll(t, s, -1)
+	if err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	want = []string{"d1@2025-01-06T12:00:03Z", "d2@2025-01-06T12:00:04Z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second drain wrote %v, want %v", got, want)
+	}
+}
+
+func TestDrainStopsWhenCancelled(t *testing.T) {
+	s := openSpool(t, t.TempDir())
+	appendAll(t, s, entry("d1", "2025-01-06T12:00:01Z"), entry("d1", "2025-01-06T12:00:02Z"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	written, err := s.Drain(ctx, func(Entry) error {
+		cancel()
+		return nil
+	})
+	if written != 1 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Drain = %d, %v, want 1, %v", written, err, context.Canceled)
+	}
+	if depth := s.Depth(); depth != 1 {
+		t.Errorf("Depth = %d, want 1", depth)
+	}
+}
+
+func TestOpenRecoversSegments(t *testing.T) {
+	d1 := entry("d1", "2025-01-06T12:00:01Z")
+	d2 := entry("d2", "2025-01-06T12:00:02Z")
+	d3 := entry("d3", "2025-01-06T12:00:03Z")
+
+	tests := []struct {
+		name  string
+		files map[string][]string // File name -> lines, built from the entries
+		depth int64
+		want  []string
+	}{
+		{
+			name: "open segment sealed in timestamp order",
+			files: map[string][]string{
+				"segment-00000000000000000001.open": {line(t, d3), line(t, d1), line(t, d2)},
+			},
+			depth: 3,
+			want:  []string{key(d1), key(d2), key(d3)},
+		},
+		{
+			name: "sealed copy wins over a left-over open segment",
+			files: map[string][]string{
+				"segment-00000000000000000001.open":   {line(t, d2), line(t, d1)},
+				"segment-00000000000000000001.ndjson": {line(t, d1), line(t, d2)},
+			},
+			depth: 2,
+			want:  []string{key(d1), key(d2)},
+		},
+		{
+			name: "partial line from a crash is skipped",
+			files: map[string][]string{
+				"segment-00000000000000000001.open": {line(t, d1), line(t, d2), line(t, d3)[:20]},
+			},
+			depth: 2,
+			want:  []string{key(d1), key(d2)},
+		},
+		{
+			name: "corrupt line in a sealed segment is skipped",
+			files: map[string][]string{
+				"segment-00000000000000000001.ndjson": {"{not json", line(t, d1)},
+				"segment-00000000000000000002.open":   {line(t, d2)},
+			},
+			depth: 2,
+			want:  []string{key(d1), key(d2)},
+		},
+		{
+			name: "unrelated files are ignored",
+			files: map[string][]string{
+				"segment-00000000000000000003.ndjson": {line(t, d3)},
+				"notes.txt":                           {"hello"},
+				"segment-bad.ndjson":                  {line(t, d1)},
+			},
+			depth: 1,
+			want:  []string{key(d3)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, lines := range tt.files {
+				writeSegment(t, dir, name, lines...)
+			}
+
+			s := openSpool(t, dir)
+			for _, name := range segmentFiles(t, dir) {
+				if strings.HasSuffix(name, openSuffix) {
+					t.Errorf("open segment %s left after Open", name)
+				}
+			}
+			if depth := s.Depth(); depth != tt.depth {
+				t.Errorf("Depth = %d, want %d", depth, tt.depth)
+			}
+
+			got, err := drainAll(t, s, -1)
+			if err != nil {
+				t.Fatalf("Drain: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("drained %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenContinuesSequence(t *testing.T) {
+	dir := t.TempDir()
+	writeSegment(t, dir, "segment-00000000000000000007.ndjson", line(t, entry("d1", "2025-01-06T12:00:01Z")))
+
+	s := openSpool(t, dir)
+	appendAll(t, s, entry("d2", "2025-01-06T12:00:02Z"))
+	if _, err := os.Stat(filepath.Join(dir, "segment-00000000000000000008.open")); err != nil {
+		t.Errorf("new segment not numbered after the existing ones: %v", err)
+	}
+}
+
+func TestOldest(t *testing.T) {
+	s := openSpool(t, t.TempDir())
+	if oldest := s.Oldest(); !oldest.IsZero() {
+		t.Errorf("Oldest of an empty spool = %v, want zero", oldest)
+	}
+
+	early := entry("d1", "2025-01-06T12:00:02Z")
+	early.SpooledAt = time.Date(2025, 1, 6, 11, 0, 0, 0, time.UTC)
+	appendAll(t, s, entry("d1", "2025-01-06T12:00:01Z"))
+	seal(s)
+	appendAll(t, s, early)
+
+	if oldest := s.Oldest(); !oldest.Equal(early.SpooledAt) {
+		t.Errorf("Oldest = %v, want %v", oldest, early.SpooledAt)
+	}
+}
@@ -0,0 +1,128 @@
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// metricColumns maps each aggregated metric to its column prefix in the
+// continuous aggregates
+var metricColumns = []struct {
+	name   string
+	prefix string
+	column string
+}{
+	{db.MetricHeartRate, "hr", "hr_bpm"},
+	{db.MetricTempC, "temp", "temp_c"},
+	{db.MetricSpO2, "spo2", "spo2_pct"},
+	{db.MetricSteps, "steps", "steps"},
+	{db.MetricBatteryPct, "battery", "battery_pct"},
+}
+
+// AggregateTelemetry summarizes a device's readings between from and to
+// into buckets of the given width. The 1m, 5m and 1h widths are served from
+// continuous aggregates; any other width is bucketed from the raw table.
+func (c *Client) AggregateTelemetry(ctx context.Context, tenantID, deviceID string, from, to time.Time, width time.Duration) ([]db.TelemetryBucket, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid bucket width %v", width)
+	}
+
+	interval := intervalString(width)
+
+	var query string
+	if view, ok := aggregateViews[interval]; ok {
+		query = viewQuery(view)
+	} else {
+		query = rawQuery()
+	}
+
+	rows, err := c.pool.Query(ctx, query, tenantID, deviceID, from.UTC(), to.UTC(), width)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate telemetry: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make([]db.TelemetryBucket, 0)
+
+	for rows.Next() {
+		var bucket db.TelemetryBucket
+		stats := make([]db.MetricStats, len(metricColumns))
+
+		dest := []interface{}{&bucket.Start, &bucket.Count, &bucket.AnomalyCount}
+		for i := range stats {
+			dest = append(dest, &stats[i].Min, &stats[i].Max, &stats[i].Avg, &stats[i].Last)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan bucket: %w", err)
+		}
+
+		bucket.Start = bucket.Start.UTC()
+		bucket.Metrics = make(map[string]*db.MetricStats, len(metricColumns))
+		for i, metric := range metricColumns {
+			bucket.Metrics[metric.name] = &stats[i]
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read buckets: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// viewQuery selects materialized buckets from a continuous aggregate.
+// Parameters: tenant, device, from, to, width.
+func viewQuery(view string) string {
+	query := "SELECT bucket, readings, anomalies"
+	for _, m := range metricColumns {
+		query += fmt.Sprintf(", %[1]s_min::float8, %[1]s_max::float8, %[1]s_avg::float8, %[1]s_last::float8", m.prefix)
+	}
+	query += fmt.Sprintf(`
+		FROM %s
+		WHERE tenant_id = $1 AND device_id = $2
+			AND bucket >= time_bucket($5::interval, $3::timestamptz) AND bucket <= $4
+		ORDER BY bucket`, view)
+
+	return query
+}
+
+// rawQuery buckets the hypertable directly, for widths without a view.
+// Parameters: tenant, device, from, to, width.
+func rawQuery() string {
+	query := "SELECT time_bucket($5::interval, ts) AS bucket, count(*), sum(CASE WHEN anomaly_flag THEN 1 ELSE 0 END)"
+	for _, m := range metricColumns {
+		query += fmt.Sprintf(", min(%[1]s)::float8, max(%[1]s)::float8, avg(%[1]s)::float8, last(%[1]s, ts)::float8", m.column)
+	}
+	query += `
+		FROM telemetry
+		WHERE tenant_id = $1 AND device_id = $2 AND ts >= $3 AND ts <= $4
+		GROUP BY bucket
+		ORDER BY bucket`
+
+	return query
+}
+
+// intervalString formats a bucket width the way the views are keyed
+func intervalString(width time.Duration) string {
+	switch {
+	case width%time.Hour == 0:
+		return plural(int(width/time.Hour), "hour")
+	case width%time.Minute == 0:
+		return plural(int(width/time.Minute), "minute")
+	default:
+		return plural(int(width/time.Second), "second")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,110 @@
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// PutAnomaly records an anomaly event, expiring it with the tenant's anomaly
+// retention. Repeats of the same event are ignored.
+func (c *Client) PutAnomaly(ctx context.Context, event db.AnomalyEvent) error {
+	ts, err := time.Parse(time.RFC3339, event.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q: %w", event.Timestamp, err)
+	}
+
+	_, err = c.pool.Exec(ctx, `
+		INSERT INTO anomaly_events (tenant_id, device_id, ts, anomaly_type, reason, severity, metric, value, threshold,
+			hr_bpm, temp_c, spo2_pct, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, `+expiresAtSQL(1, 3, 13)+`)
+		ON CONFLICT DO NOTHING`,
+		event.TenantID, event.DeviceID, ts, event.AnomalyType, event.Reason,
+		event.Severity, event.Metric, event.Value, event.Threshold,
+		event.HeartRate, event.TempC, event.SpO2, true,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert anomaly: %w", err)
+	}
+
+	return nil
+}
+
+// QueryAnomalies returns one page of a tenant's anomaly events, newest first
+func (c *Client) QueryAnomalies(ctx context.Context, tenantID string, q db.AnomalyQuery) (*db.AnomalyPage, error) {
+	args := []interface{}{
+		tenantID,
+		q.From.UTC().Truncate(time.Second),
+		q.To.UTC().Truncate(time.Second),
+	}
+	query := `
+		SELECT tenant_id, device_id, ts, anomaly_type, reason, severity, metric, value, threshold,
+			hr_bpm, temp_c, spo2_pct
+		FROM anomaly_events
+		WHERE tenant_id = $1 AND ts >= $2 AND ts <= $3`
+
+	if q.DeviceID != "" {
+		args = append(args, q.DeviceID)
+		query += fmt.Sprintf(" AND device_id = $%d", len(args))
+	}
+	if q.AnomalyType != "" {
+		args = append(args, q.AnomalyType)
+		query += fmt.Sprintf(" AND anomaly_type = $%d", len(args))
+	}
+
+	if q.Cursor != "" {
+		after, key, err := decodeCursor(q.Cursor, 2)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, after, key[0], key[1])
+		query += fmt.Sprintf(" AND (ts, device_id, anomaly_type) < ($%d, $%d, $%d)", len(args)-2, len(args)-1, len(args))
+	}
+
+	query += " ORDER BY ts DESC, device_id DESC, anomaly_type DESC"
+
+	// Fetch one extra row to learn whether another page exists
+	if q.Limit > 0 {
+		args = append(args, q.Limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := c.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	page := &db.AnomalyPage{Events: make([]db.AnomalyEvent, 0)}
+
+	for rows.Next() {
+		var event db.AnomalyEvent
+		var ts time.Time
+
+		err := rows.Scan(
+			&event.TenantID, &event.DeviceID, &ts, &event.AnomalyType, &event.Reason,
+			&event.Severity, &event.Metric, &event.Value, &event.Threshold,
+			&event.HeartRate, &event.TempC, &event.SpO2,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+
+		event.Timestamp = ts.UTC().Format(time.RFC3339)
+		page.Events = append(page.Events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read anomalies: %w", err)
+	}
+
+	if q.Limit > 0 && len(page.Events) > int(q.Limit) {
+		page.Events = page.Events[:q.Limit]
+		last := page.Events[len(page.Events)-1]
+		page.NextCursor = encodeCursor(last.Timestamp, last.DeviceID, last.AnomalyType)
+	}
+
+	return page, nil
+}
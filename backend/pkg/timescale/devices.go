@@ -0,0 +1,146 @@
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+const deviceColumns = `tenant_id, device_id, model, fw_version, patient_id, ward, status, created_at, updated_at`
+
+// CreateDevice adds a device to the registry and returns the stored entry,
+// failing with db.ErrDeviceExists if it is already registered
+func (c *Client) CreateDevice(ctx context.Context, device db.Device) (*db.Device, error) {
+	if device.Status == "" {
+		device.Status = db.DeviceStatusActive
+	}
+
+	rows, err := c.pool.Query(ctx, `
+		INSERT INTO devices (`+deviceColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now(), now())
+		ON CONFLICT (tenant_id, device_id) DO NOTHING
+		RETURNING `+deviceColumns,
+		device.TenantID, device.DeviceID, device.Model, device.FWVersion,
+		device.PatientID, device.Ward, device.Status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert device: %w", err)
+	}
+
+	created, err := scanDevice(rows)
+	if isNoRows(err) {
+		return nil, db.ErrDeviceExists
+	}
+
+	return created, err
+}
+
+// GetDevice retrieves a single registry entry
+func (c *Client) GetDevice(ctx context.Context, tenantID, deviceID string) (*db.Device, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE tenant_id = $1 AND device_id = $2`,
+		tenantID, deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+
+	device, err := scanDevice(rows)
+	if isNoRows(err) {
+		return nil, db.ErrDeviceNotFound
+	}
+
+	return device, err
+}
+
+// ListDevices returns every registered device for a tenant, ordered by ID
+func (c *Client) ListDevices(ctx context.Context, tenantID string) ([]db.Device, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE tenant_id = $1
+		ORDER BY device_id`,
+		tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	devices, err := pgx.CollectRows(rows, rowToDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// UpdateDevice replaces an existing registry entry and returns the stored
+// entry, failing with db.ErrDeviceNotFound if the device is not registered
+func (c *Client) UpdateDevice(ctx context.Context, device db.Device) (*db.Device, error) {
+	rows, err := c.pool.Query(ctx, `
+		UPDATE devices SET
+			model = $3, fw_version = $4, patient_id = $5, ward = $6, status = $7,
+			updated_at = now()
+		WHERE tenant_id = $1 AND device_id = $2
+		RETURNING `+deviceColumns,
+		device.TenantID, device.DeviceID, device.Model, device.FWVersion,
+		device.PatientID, device.Ward, device.Status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update device: %w", err)
+	}
+
+	updated, err := scanDevice(rows)
+	if isNoRows(err) {
+		return nil, db.ErrDeviceNotFound
+	}
+
+	return updated, err
+}
+
+// DeleteDevice removes a device from the registry. Its telemetry is kept.
+func (c *Client) DeleteDevice(ctx context.Context, tenantID, deviceID string) error {
+	tag, err := c.pool.Exec(ctx, `DELETE FROM devices WHERE tenant_id = $1 AND device_id = $2`, tenantID, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return db.ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// scanDevice reads exactly one device row, returning pgx.ErrNoRows if
+// there is none
+func scanDevice(rows pgx.Rows) (*db.Device, error) {
+	device, err := pgx.CollectExactlyOneRow(rows, rowToDevice)
+	if isNoRows(err) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to scan device: %w", err)
+	}
+
+	return &device, nil
+}
+
+func rowToDevice(row pgx.CollectableRow) (db.Device, error) {
+	var device db.Device
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(
+		&device.TenantID, &device.DeviceID, &device.Model, &device.FWVersion,
+		&device.PatientID, &device.Ward, &device.Status, &createdAt, &updatedAt,
+	)
+
+	device.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	device.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+
+	return device, err
+}
@@ -0,0 +1,69 @@
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+// expiresAtSQL returns the expression for a row's expiry, given the
+// placeholder numbers of its tenant ID, reading timestamp and anomaly flag.
+// The expiry counts from the reading, so a late or replayed one is not kept
+// longer. Tenants without a policy get the default retention.
+func expiresAtSQL(tenantArg, tsArg, anomalyArg int) string {
+	return fmt.Sprintf(`$%d + make_interval(days => COALESCE(
+		(SELECT CASE WHEN $%d THEN anomaly_days ELSE normal_days END
+			FROM tenant_retention WHERE tenant_id = $%d),
+		%d))`, tsArg, anomalyArg, tenantArg, db.DefaultRetentionDays)
+}
+
+// GetRetentionPolicy returns a tenant's retention policy, or the default
+// policy if none has been set
+func (c *Client) GetRetentionPolicy(ctx context.Context, tenantID string) (*db.RetentionPolicy, error) {
+	policy := db.RetentionPolicy{TenantID: tenantID}
+	var updatedAt time.Time
+
+	err := c.pool.QueryRow(ctx, `
+		SELECT normal_days, anomaly_days, updated_at
+		FROM tenant_retention
+		WHERE tenant_id = $1`,
+		tenantID,
+	).Scan(&policy.NormalDays, &policy.AnomalyDays, &updatedAt)
+	if isNoRows(err) {
+		policy = db.DefaultRetentionPolicy(tenantID)
+		return &policy, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+
+	policy.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return &policy, nil
+}
+
+// PutRetentionPolicy sets a tenant's retention policy. It applies to rows
+// written from then on; existing rows keep the expiry they were written with.
+func (c *Client) PutRetentionPolicy(ctx context.Context, policy db.RetentionPolicy) (*db.RetentionPolicy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	var updatedAt time.Time
+	err := c.pool.QueryRow(ctx, `
+		INSERT INTO tenant_retention (tenant_id, normal_days, anomaly_days, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			normal_days = EXCLUDED.normal_days,
+			anomaly_days = EXCLUDED.anomaly_days,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at`,
+		policy.TenantID, policy.NormalDays, policy.AnomalyDays,
+	).Scan(&updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put retention policy: %w", err)
+	}
+
+	policy.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return &policy, nil
+}
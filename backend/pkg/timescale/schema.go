@@ -0,0 +1,148 @@
+package timescale
+
+import (
+	"context"
+	"fmt"
+)
+
+// aggregateViews maps bucket widths to the continuous aggregate that backs
+// them. The views are created by migrate.
+var aggregateViews = map[string]string{
+	"1 minute":  "telemetry_1m",
+	"5 minutes": "telemetry_5m",
+	"1 hour":    "telemetry_1h",
+}
+
+// schema creates the hypertables and registry. Every statement is idempotent
+// so it runs on each startup.
+var schema = []string{
+	`CREATE EXTENSION IF NOT EXISTS timescaledb`,
+
+	`CREATE TABLE IF NOT EXISTS telemetry (
+		tenant_id     TEXT             NOT NULL,
+		device_id     TEXT             NOT NULL,
+		ts            TIMESTAMPTZ      NOT NULL,
+		hr_bpm        INTEGER          NOT NULL,
+		temp_c        DOUBLE PRECISION NOT NULL,
+		spo2_pct      INTEGER          NOT NULL,
+		steps         INTEGER          NOT NULL,
+		battery_pct   INTEGER          NOT NULL,
+		fw_version    TEXT             NOT NULL DEFAULT '',
+		anomaly_flag  BOOLEAN          NOT NULL DEFAULT FALSE,
+		anomaly_type  TEXT             NOT NULL DEFAULT '',
+		msg_id        TEXT             NOT NULL DEFAULT '',
+		seq           BIGINT           NOT NULL DEFAULT 0,
+		msg_key       TEXT             NOT NULL,
+		quality_flags TEXT[]           NOT NULL DEFAULT '{}',
+		ews_score     INTEGER, -- NULL for readings that were not scored
+		ews_band      TEXT             NOT NULL DEFAULT '',
+		expires_at    TIMESTAMPTZ,
+		PRIMARY KEY (tenant_id, device_id, ts, msg_key)
+	)`,
+
+	// Time-partitioned, with devices hashed across space partitions
+	`SELECT create_hypertable('telemetry', 'ts',
+		partitioning_column => 'device_id',
+		number_partitions => 4,
+		if_not_exists => TRUE)`,
+
+	`CREATE TABLE IF NOT EXISTS devices (
+		tenant_id  TEXT        NOT NULL,
+		device_id  TEXT        NOT NULL,
+		model      TEXT        NOT NULL DEFAULT '',
+		fw_version TEXT        NOT NULL DEFAULT '',
+		patient_id TEXT        NOT NULL DEFAULT '',
+		ward       TEXT        NOT NULL DEFAULT '',
+		status     TEXT        NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (tenant_id, device_id)
+	)`,
+
+	// Each finding of a reading is its own event
+	`CREATE TABLE IF NOT EXISTS anomaly_events (
+		tenant_id    TEXT             NOT NULL,
+		device_id    TEXT             NOT NULL,
+		ts           TIMESTAMPTZ      NOT NULL,
+		anomaly_type TEXT             NOT NULL,
+		reason       TEXT             NOT NULL DEFAULT '',
+		severity     TEXT             NOT NULL,
+		metric       TEXT             NOT NULL DEFAULT '',
+		value        DOUBLE PRECISION NOT NULL DEFAULT 0,
+		threshold    DOUBLE PRECISION NOT NULL DEFAULT 0,
+		hr_bpm       INTEGER          NOT NULL,
+		temp_c       DOUBLE PRECISION NOT NULL,
+		spo2_pct     INTEGER          NOT NULL,
+		expires_at   TIMESTAMPTZ,
+		PRIMARY KEY (tenant_id, ts, device_id, anomaly_type)
+	)`,
+
+	`SELECT create_hypertable('anomaly_events', 'ts', if_not_exists => TRUE)`,
+
+	`CREATE TABLE IF NOT EXISTS tenant_retention (
+		tenant_id    TEXT        PRIMARY KEY,
+		normal_days  INTEGER     NOT NULL,
+		anomaly_days INTEGER     NOT NULL,
+		updated_at   TIMESTAMPTZ NOT NULL
+	)`,
+
+	// Rows carry their own expiry, set at write time from the tenant's
+	// retention policy, and a background job deletes them once it passes
+	`CREATE INDEX IF NOT EXISTS telemetry_expires_at_idx ON telemetry (expires_at)`,
+	`CREATE INDEX IF NOT EXISTS anomaly_events_expires_at_idx ON anomaly_events (expires_at)`,
+
+	`CREATE OR REPLACE PROCEDURE purge_expired(job_id INTEGER, config JSONB)
+	LANGUAGE SQL AS $$
+		DELETE FROM telemetry WHERE expires_at < now();
+		DELETE FROM anomaly_events WHERE expires_at < now();
+	$$`,
+
+	`SELECT add_job('purge_expired', INTERVAL '1 hour')
+	WHERE NOT EXISTS (
+		SELECT 1 FROM timescaledb_information.jobs WHERE proc_name = 'purge_expired'
+	)`,
+}
+
+// continuousAggregate returns the statements that create one bucket view
+// and its refresh policy. Real-time aggregation is enabled so the newest,
+// not yet materialized buckets are still returned.
+func continuousAggregate(view, width string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+		WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+		SELECT tenant_id, device_id,
+			time_bucket(INTERVAL '%s', ts) AS bucket,
+			count(*) AS readings,
+			sum(CASE WHEN anomaly_flag THEN 1 ELSE 0 END) AS anomalies,
+			min(hr_bpm) AS hr_min, max(hr_bpm) AS hr_max, avg(hr_bpm) AS hr_avg, last(hr_bpm, ts) AS hr_last,
+			min(temp_c) AS temp_min, max(temp_c) AS temp_max, avg(temp_c) AS temp_avg, last(temp_c, ts) AS temp_last,
+			min(spo2_pct) AS spo2_min, max(spo2_pct) AS spo2_max, avg(spo2_pct) AS spo2_avg, last(spo2_pct, ts) AS spo2_last,
+			min(steps) AS steps_min, max(steps) AS steps_max, avg(steps) AS steps_avg, last(steps, ts) AS steps_last,
+			min(battery_pct) AS battery_min, max(battery_pct) AS battery_max, avg(battery_pct) AS battery_avg, last(battery_pct, ts) AS battery_last
+		FROM telemetry
+		GROUP BY tenant_id, device_id, bucket
+		WITH NO DATA`, view, width),
+
+		fmt.Sprintf(`SELECT add_continuous_aggregate_policy('%s',
+			start_offset => INTERVAL '3 days',
+			end_offset => INTERVAL '%s',
+			schedule_interval => INTERVAL '%s',
+			if_not_exists => TRUE)`, view, width, width),
+	}
+}
+
+// migrate applies the schema and continuous aggregates
+func (c *Client) migrate(ctx context.Context) error {
+	statements := append([]string{}, schema...)
+	for width, view := range aggregateViews {
+		statements = append(statements, continuousAggregate(view, width)...)
+	}
+
+	for _, stmt := range statements {
+		if _, err := c.pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to apply schema: %w", err)
+		}
+	}
+
+	return nil
+}
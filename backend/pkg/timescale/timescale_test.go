@@ -0,0 +1,44 @@
+package timescale
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meghanan266/healthsense/backend/pkg/db"
+)
+
+func TestCursor(t *testing.T) {
+	record := db.TelemetryRecord{TenantID: "acme-clinic", DeviceID: "patient-001", Timestamp: "2025-01-06T13:00:00+01:00", Seq: 7}
+	key := db.MessageKey(record)
+
+	ts, rest, err := decodeCursor(encodeCursor(record.Timestamp, key), 1)
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if want := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC); !ts.Equal(want) {
+		t.Errorf("timestamp %v, want %v", ts, want)
+	}
+	if !reflect.DeepEqual(rest, []string{key}) {
+		t.Errorf("key columns %q, want %q", rest, []string{key})
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "missing message key", cursor: encodeCursor(record.Timestamp)},
+		{name: "extra key column", cursor: encodeCursor(record.Timestamp, key, "patient-001")},
+		{name: "invalid timestamp", cursor: encodeCursor("yesterday", key)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCursor(tt.cursor, 1); !errors.Is(err, db.ErrInvalidCursor) {
+				t.Errorf("decodeCursor error = %v, want %v", err, db.ErrInvalidCursor)
+			}
+		})
+	}
+}